@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	coreTypes "k8s.io/api/core/v1"
+	networkingTypes "k8s.io/api/networking/v1"
+	rbacTypes "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func groupBinding(name, clusterRole string, groups ...string) rbacTypes.RoleBinding {
+	binding := rbacTypes.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: name}, RoleRef: rbacTypes.RoleRef{Kind: "ClusterRole", Name: clusterRole}}
+	for _, group := range groups {
+		binding.Subjects = append(binding.Subjects, rbacTypes.Subject{Kind: rbacTypes.GroupKind, Name: group})
+	}
+	return binding
+}
+
+func hardQuota(name string, hard map[string]string) coreTypes.ResourceQuota {
+	quota := coreTypes.ResourceQuota{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: coreTypes.ResourceQuotaSpec{Hard: coreTypes.ResourceList{}}}
+	for resourceName, value := range hard {
+		quota.Spec.Hard[coreTypes.ResourceName(resourceName)] = resource.MustParse(value)
+	}
+	return quota
+}
+
+func TestReconstruct(t *testing.T) {
+
+	bindings := []rbacTypes.RoleBinding{
+		groupBinding("adgroup-edit-binding", "edit", "RES-DEV-OPSH-DEVELOPER-BOOGIE_TEST"),
+		groupBinding("adgroup-view-binding", "view", "RES-DEV-OPSH-VIEWER-BOOGIE_TEST"),
+		groupBinding("adgroup-deploy-binding", "admin", "RES-DEV-OPSH-DEPLOY-RELMAN"),
+	}
+	quotas := []coreTypes.ResourceQuota{hardQuota("default-quotas", map[string]string{
+		"limits.cpu":             "500m",
+		"limits.memory":          "1024Mi",
+		"persistentvolumeclaims": "2",
+		"requests.storage":       "10Gi",
+	})}
+
+	got, _ := json.Marshal(reconstruct("boogie-test", bindings, quotas))
+	want := `{"input":{"projectname":"boogie-test","environment":"dev","optionals":[` +
+		`{"name":"cpu","count":500,"unit":"m"},{"name":"memory","count":1,"unit":"Gi"},{"name":"volumes","count":2},{"name":"storage","count":10,"unit":"Gi"}]},` +
+		`"findings":[]}`
+	if string(got) != want {
+		t.Errorf("wanted \n%s, \nbut got \n%s \n", want, got)
+	}
+
+	// a legacy project, which does not fit
+	bindings = []rbacTypes.RoleBinding{
+		groupBinding("edit", "edit", "RES-TST-OPSH-DEVELOPER-BOOGIE_TEST", "RES-TST-OPSH-VIEWER-OTHER_PROJECT"),
+		groupBinding("view", "view", "RES-DEV-OPSH-VIEWER-BOOGIE_TEST", "legacy-admins"),
+		groupBinding("everything", "cluster-admin", "RES-TST-OPSH-MANAGE-RELMAN"),
+		{ObjectMeta: metav1.ObjectMeta{Name: "direct"}, RoleRef: rbacTypes.RoleRef{Kind: "ClusterRole", Name: "edit"},
+			Subjects: []rbacTypes.Subject{{Kind: rbacTypes.UserKind, Name: "alice"}, {Kind: rbacTypes.ServiceAccountKind, Name: "builder"}}},
+		// OpenShift's own bindings are left out
+		{ObjectMeta: metav1.ObjectMeta{Name: "system:image-pullers"}, RoleRef: rbacTypes.RoleRef{Kind: "ClusterRole", Name: "system:image-puller"},
+			Subjects: []rbacTypes.Subject{{Kind: rbacTypes.GroupKind, Name: "system:serviceaccounts:boogie-test"}}},
+	}
+	quotas = []coreTypes.ResourceQuota{hardQuota("legacy", map[string]string{
+		"limits.cpu":    "1.5",
+		"limits.memory": "2000001",
+		"pods":          "10",
+	})}
+
+	got, _ = json.Marshal(reconstruct("boogie-test", bindings, quotas))
+	want = `{"input":{"projectname":"boogie-test","environment":"tst","optionals":[{"name":"cpu","count":1500,"unit":"m"}]},"findings":[` +
+		`"rolebinding edit binds group RES-TST-OPSH-VIEWER-OTHER_PROJECT, which belongs to another project",` +
+		`"rolebinding edit binds group RES-TST-OPSH-VIEWER-OTHER_PROJECT to ClusterRole edit, rather than ClusterRole view",` +
+		`"rolebinding view binds group legacy-admins, which is not a RES-*-OPSH-* group",` +
+		`"rolebinding everything binds group RES-TST-OPSH-MANAGE-RELMAN to ClusterRole cluster-admin, rather than ClusterRole deploy",` +
+		`"rolebinding direct binds User alice directly, rather than through a group",` +
+		`"rolebinding direct binds ServiceAccount builder directly, rather than through a group",` +
+		`"groups from more than one environment are bound: tst, dev, assuming tst",` +
+		`"resourcequota legacy sets limits.memory=2000001, which cannot be expressed as the memory optional",` +
+		`"resourcequota legacy sets pods=10, which no optional produces"]}`
+	if string(got) != want {
+		t.Errorf("wanted \n%s, \nbut got \n%s \n", want, got)
+	}
+}
+
+func TestManyNamespaces(t *testing.T) {
+
+	var objects []runtime.Object
+	for i := 0; i < 5; i++ {
+		name := fmt.Sprintf("project-%d", i)
+		env := "dev"
+		if i%2 == 0 {
+			env = "prod"
+		}
+		objects = append(objects,
+			&coreTypes.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"env": env}}},
+			&rbacTypes.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "edit", Namespace: name}, Subjects: []rbacTypes.Subject{{Kind: rbacTypes.GroupKind, Name: "group-" + name}}},
+		)
+	}
+	quota := hardQuota("default-quotas", map[string]string{"limits.cpu": "2"})
+	quota.Namespace = "project-0"
+	objects = append(objects, &quota)
+	clientset := fake.NewSimpleClientset(objects...)
+	c := clients{core: clientset.CoreV1(), rbac: clientset.RbacV1(), networking: clientset.NetworkingV1(), dynamic: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())}
+
+	namespaces, err := getNamespaceList(clientset.CoreV1(), "env=prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(namespaces.NameSpaces); got != "[project-0 project-2 project-4]" {
+		t.Errorf("wanted %s, but got %s: \n", "[project-0 project-2 project-4]", got)
+	}
+
+	// one namespace cannot be read, and another is deleted once listed, neither of which stops the rest
+	clientset.PrependReactor("list", "rolebindings", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetNamespace() != "project-2" {
+			return false, nil, nil
+		}
+		return true, nil, apierrors.NewForbidden(rbacTypes.Resource("rolebindings"), "", errors.New("not allowed"))
+	})
+	results, failures := getResultsFor(c, append(namespaces.NameSpaces, "project-deleted"), 2)
+	summary := make(map[string]string)
+	for namespace, result := range results {
+		b, _ := json.Marshal(subjectNames(result.RoleBindings))
+		q, _ := json.Marshal(hardLimits(result.Quotas))
+		summary[namespace] = string(b) + " " + string(q)
+	}
+	got, _ := json.Marshal(summary)
+	want := `{"project-0":"[\"group-project-0\"] [{\"limits.cpu\":\"2\"}]","project-4":"[\"group-project-4\"] null"}`
+	if string(got) != want {
+		t.Errorf("wanted \n%s, \nbut got \n%s \n", want, got)
+	}
+	got, _ = json.Marshal(failures)
+	want = `{"project-2":"generate list of role bindings failed: rolebindings.rbac.authorization.k8s.io is forbidden: not allowed"}`
+	if string(got) != want {
+		t.Errorf("wanted \n%s, \nbut got \n%s \n", want, got)
+	}
+}
+
+func TestEveryGeneratedKind(t *testing.T) {
+
+	clientset := fake.NewSimpleClientset(
+		&coreTypes.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "boogie-test", Labels: map[string]string{"env": "dev"}, Annotations: map[string]string{"openshift.io/requester": "someone"}}},
+		&coreTypes.LimitRange{ObjectMeta: metav1.ObjectMeta{Name: "default-limits", Namespace: "boogie-test"}, Spec: coreTypes.LimitRangeSpec{
+			Limits: []coreTypes.LimitRangeItem{{Type: coreTypes.LimitTypeContainer, Default: coreTypes.ResourceList{"cpu": resource.MustParse("100m")}}},
+		}},
+		&networkingTypes.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: "default-deny-all", Namespace: "boogie-test"}},
+	)
+	project := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "project.openshift.io/v1", "kind": "Project",
+		"metadata": map[string]interface{}{"name": "boogie-test", "annotations": map[string]interface{}{"openshift.io/display-name": "Boogie"}},
+		"status":   map[string]interface{}{"phase": "Active"},
+	}}
+	egress := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "network.openshift.io/v1", "kind": "EgressNetworkPolicy",
+		"metadata": map[string]interface{}{"name": "default-egress", "namespace": "boogie-test"},
+		"spec":     map[string]interface{}{"egress": []interface{}{map[string]interface{}{"type": "Deny", "to": map[string]interface{}{"cidrSelector": "0.0.0.0/0"}}}},
+	}}
+	c := clients{core: clientset.CoreV1(), rbac: clientset.RbacV1(), networking: clientset.NetworkingV1(), dynamic: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), project, egress)}
+
+	result, err := getResults(c, "boogie-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := json.Marshal(result)
+	want := `{"namespace":{"name":"boogie-test","labels":{"env":"dev"},"annotations":{"openshift.io/requester":"someone"}},` +
+		`"project":{"name":"boogie-test","annotations":{"openshift.io/display-name":"Boogie"},"phase":"Active"},` +
+		`"rolebindings":null,"quotas":null,` +
+		`"limitranges":[{"name":"default-limits","spec":{"limits":[{"type":"Container","default":{"cpu":"100m"}}]}}],` +
+		`"networkpolicies":[{"name":"default-deny-all","spec":{"podSelector":{}}}],` +
+		`"egressnetworkpolicies":[{"name":"default-egress","spec":{"egress":[{"to":{"cidrSelector":"0.0.0.0/0"},"type":"Deny"}]}}]}`
+	if string(got) != want {
+		t.Errorf("wanted \n%s, \nbut got \n%s \n", want, got)
+	}
+
+	// on a cluster without the OpenShift kinds, they are left out rather than failing
+	c.dynamic = dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	result, err = getResults(c, "boogie-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Project != nil || len(result.EgressNetworkPolicies) != 0 {
+		t.Errorf("wanted %s, but got %v: \n", "no OpenShift kinds", result)
+	}
+}
+
+func TestRoleBindings(t *testing.T) {
+
+	clientset := fake.NewSimpleClientset(
+		&rbacTypes.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "adgroup-edit-binding", Namespace: "boogie-test"},
+			RoleRef:    rbacTypes.RoleRef{APIGroup: rbacTypes.GroupName, Kind: "ClusterRole", Name: "admin"},
+			Subjects: []rbacTypes.Subject{
+				{Kind: rbacTypes.GroupKind, APIGroup: rbacTypes.GroupName, Name: "RES-DEV-OPSH-DEVELOPER-BOOGIE_TEST"},
+				{Kind: rbacTypes.ServiceAccountKind, Name: "jenkins", Namespace: "cicd"},
+			},
+		},
+	)
+
+	bindings, err := getRoleBindings(clientset.RbacV1(), "boogie-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := resultList{RoleBindings: bindings.RoleBindings}
+
+	got, _ := json.Marshal(results.RoleBindings)
+	want := `[{"name":"adgroup-edit-binding","roleRef":{"kind":"ClusterRole","name":"admin"},"subjects":[` +
+		`{"kind":"Group","name":"RES-DEV-OPSH-DEVELOPER-BOOGIE_TEST"},{"kind":"ServiceAccount","name":"jenkins","namespace":"cicd"}]}]`
+	if string(got) != want {
+		t.Errorf("wanted \n%s, \nbut got \n%s \n", want, got)
+	}
+
+	// the compatibility mode keeps the old flat list, under the same key
+	got, _ = json.Marshal(results.compat())
+	if !strings.Contains(string(got), `"rolebindings":["RES-DEV-OPSH-DEVELOPER-BOOGIE_TEST","jenkins"]`) {
+		t.Errorf("wanted %s, but got %s: \n", `"rolebindings":["RES-DEV-OPSH-DEVELOPER-BOOGIE_TEST","jenkins"]`, got)
+	}
+	if strings.Count(string(got), `"rolebindings"`) != 1 {
+		t.Errorf("wanted %s, but got %s: \n", "a single rolebindings key", got)
+	}
+}
+
+func TestQuotaUtilization(t *testing.T) {
+
+	quota := hardQuota("default-quotas", map[string]string{
+		"limits.cpu":             "2",
+		"limits.memory":          "1Gi",
+		"persistentvolumeclaims": "3",
+		"requests.storage":       "0",
+	})
+	quota.Namespace = "boogie-test"
+	quota.Spec.Scopes = []coreTypes.ResourceQuotaScope{coreTypes.ResourceQuotaScopeNotTerminating}
+	quota.Status.Used = coreTypes.ResourceList{
+		"limits.cpu":             resource.MustParse("500m"),
+		"limits.memory":          resource.MustParse("768Mi"),
+		"persistentvolumeclaims": resource.MustParse("1"),
+		"requests.storage":       resource.MustParse("0"),
+	}
+	clientset := fake.NewSimpleClientset(&quota)
+
+	quotas, err := getQuotas(clientset.CoreV1(), "boogie-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := json.Marshal(quotas.Quotas)
+	want := `[{"name":"default-quotas","scopes":["NotTerminating"],` +
+		`"hard":{"limits.cpu":"2","limits.memory":"1Gi","persistentvolumeclaims":"3","requests.storage":"0"},` +
+		`"used":{"limits.cpu":"500m","limits.memory":"768Mi","persistentvolumeclaims":"1","requests.storage":"0"},` +
+		`"utilization":{"limits.cpu":25,"limits.memory":75,"persistentvolumeclaims":33.3}}]`
+	if string(got) != want {
+		t.Errorf("wanted \n%s, \nbut got \n%s \n", want, got)
+	}
+
+	// limits too large for MilliValue are still exact
+	large := utilization(
+		coreTypes.ResourceList{"requests.storage": resource.MustParse("16Pi"), "count/secrets": resource.MustParse("1E")},
+		coreTypes.ResourceList{"requests.storage": resource.MustParse("4Pi"), "count/secrets": resource.MustParse("333P")},
+	)
+	if large["requests.storage"] != 25 || large["count/secrets"] != 33.3 {
+		t.Errorf("wanted %s, but got %v: \n", "25 and 33.3", large)
+	}
+
+	// the compatibility mode keeps the hard limits alone
+	got, _ = json.Marshal(resultList{Quotas: quotas.Quotas}.compat())
+	if !strings.Contains(string(got), `"quotas":[{"limits.cpu":"2","limits.memory":"1Gi","persistentvolumeclaims":"3","requests.storage":"0"}]`) {
+		t.Errorf("wanted %s, but got %s: \n", "the hard limits alone", got)
+	}
+}
@@ -2,39 +2,91 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"math"
+	"math/big"
 
+	"github.com/nicgrobler/gobins/internal/kubeconfig"
 	coreTypes "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	core "k8s.io/client-go/kubernetes/typed/core/v1"
+	networking "k8s.io/client-go/kubernetes/typed/networking/v1"
 	rbac "k8s.io/client-go/kubernetes/typed/rbac/v1"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
 )
 
 type resultList struct {
-	RoleBindings []string                 `json:"rolebindings"`
-	Quotas       []coreTypes.ResourceList `json:"quotas"`
+	Namespace             objectMetadata        `json:"namespace"`
+	Project               *project              `json:"project,omitempty"`
+	RoleBindings          []roleBinding         `json:"rolebindings"`
+	Quotas                []quota               `json:"quotas"`
+	LimitRanges           []limitRange          `json:"limitranges"`
+	NetworkPolicies       []networkPolicy       `json:"networkpolicies"`
+	EgressNetworkPolicies []egressNetworkPolicy `json:"egressnetworkpolicies"`
+}
+
+// clients holds everything needed to read a namespace back
+type clients struct {
+	core       core.CoreV1Interface
+	rbac       rbac.RbacV1Interface
+	networking networking.NetworkingV1Interface
+	dynamic    dynamic.Interface
 }
 
 type namespaceList struct {
 	NameSpaces []string `json:"namespaces"`
 }
 
+// compatResultList is the shape results had before bindings and quotas were reported in full: a flat list of
+// subject names, and the hard limits of each quota
+type compatResultList struct {
+	resultList
+	RoleBindings []string                 `json:"rolebindings"`
+	Quotas       []coreTypes.ResourceList `json:"quotas"`
+}
+
+type roleRef struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+type subject struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"` // only set for ServiceAccounts
+}
+
+type roleBinding struct {
+	Name     string    `json:"name"`
+	RoleRef  roleRef   `json:"roleRef"`
+	Subjects []subject `json:"subjects"`
+}
+
 type bindindingsList struct {
-	RoleBindings []string `json:"rolebindings"`
+	RoleBindings []roleBinding `json:"rolebindings"`
+}
+
+type quota struct {
+	Name        string                             `json:"name"`
+	Scopes      []coreTypes.ResourceQuotaScope     `json:"scopes,omitempty"`
+	Hard        coreTypes.ResourceList             `json:"hard"`
+	Used        coreTypes.ResourceList             `json:"used"`
+	Utilization map[coreTypes.ResourceName]float64 `json:"utilization"` // percentage of hard in use, per resource
 }
 
 type quotasList struct {
-	Quotas []coreTypes.ResourceList `json:"quotas"`
+	Quotas []quota `json:"quotas"`
 }
 
-func getNamespaceList(client *core.CoreV1Client) (namespaceList, error) {
+func getNamespaceList(client core.CoreV1Interface, selector string) (namespaceList, error) {
 	list := namespaceList{}
-	spaces, err := client.Namespaces().List(metav1.ListOptions{})
+	spaces, err := client.Namespaces().List(metav1.ListOptions{LabelSelector: selector})
 	if err != nil {
 		return list, err
 	}
@@ -44,7 +96,7 @@ func getNamespaceList(client *core.CoreV1Client) (namespaceList, error) {
 	return list, nil
 }
 
-func getRoleBindings(client *rbac.RbacV1Client, namespace string) (bindindingsList, error) {
+func getRoleBindings(client rbac.RbacV1Interface, namespace string) (bindindingsList, error) {
 
 	list := bindindingsList{}
 	bindings, err := client.RoleBindings(namespace).List(metav1.ListOptions{})
@@ -52,16 +104,32 @@ func getRoleBindings(client *rbac.RbacV1Client, namespace string) (bindindingsLi
 		return list, err
 	}
 	for _, item := range bindings.Items {
-		for _, subject := range item.Subjects {
-			list.RoleBindings = append(list.RoleBindings, subject.Name)
+		binding := roleBinding{Name: item.Name, RoleRef: roleRef{Kind: item.RoleRef.Kind, Name: item.RoleRef.Name}, Subjects: []subject{}}
+		for _, s := range item.Subjects {
+			binding.Subjects = append(binding.Subjects, subject{Kind: s.Kind, Name: s.Name, Namespace: s.Namespace})
 		}
-
+		list.RoleBindings = append(list.RoleBindings, binding)
 	}
 
 	return list, nil
 }
 
-func getQuotas(client *core.CoreV1Client, namespace string) (quotasList, error) {
+func subjectNames(bindings []roleBinding) []string {
+	// every subject of every binding, by name alone
+	var names []string
+	for _, binding := range bindings {
+		for _, s := range binding.Subjects {
+			names = append(names, s.Name)
+		}
+	}
+	return names
+}
+
+func (results resultList) compat() compatResultList {
+	return compatResultList{resultList: results, RoleBindings: subjectNames(results.RoleBindings), Quotas: hardLimits(results.Quotas)}
+}
+
+func getQuotas(client core.CoreV1Interface, namespace string) (quotasList, error) {
 
 	list := quotasList{}
 	quotas, err := client.ResourceQuotas(namespace).List(metav1.ListOptions{})
@@ -69,12 +137,46 @@ func getQuotas(client *core.CoreV1Client, namespace string) (quotasList, error)
 		return list, err
 	}
 	for _, item := range quotas.Items {
-		list.Quotas = append(list.Quotas, item.Spec.Hard)
+		list.Quotas = append(list.Quotas, quota{
+			Name:        item.Name,
+			Scopes:      item.Spec.Scopes,
+			Hard:        item.Spec.Hard,
+			Used:        item.Status.Used,
+			Utilization: utilization(item.Spec.Hard, item.Status.Used),
+		})
 	}
 
 	return list, nil
 }
 
+func utilization(hard, used coreTypes.ResourceList) map[coreTypes.ResourceName]float64 {
+	// used as a percentage of hard, to one decimal place, left out where hard is zero
+	percentages := make(map[coreTypes.ResourceName]float64, len(hard))
+	for name, limit := range hard {
+		if limit.IsZero() {
+			continue
+		}
+		inUse := used[name]
+		ratio, _ := new(big.Float).Quo(exactValue(inUse), exactValue(limit)).Float64()
+		percentages[name] = math.Round(ratio*1000) / 10
+	}
+	return percentages
+}
+
+func exactValue(q resource.Quantity) *big.Float {
+	// MilliValue overflows for large storage and object count limits, the decimal form never does
+	f, _ := new(big.Float).SetString(q.AsDec().String())
+	return f
+}
+
+func hardLimits(quotas []quota) []coreTypes.ResourceList {
+	var hard []coreTypes.ResourceList
+	for _, q := range quotas {
+		hard = append(hard, q.Hard)
+	}
+	return hard
+}
+
 func isNamespacePresent(nameSpace string, nameSpaces []string) bool {
 	for _, name := range nameSpaces {
 		if name == nameSpace {
@@ -84,34 +186,14 @@ func isNamespacePresent(nameSpace string, nameSpaces []string) bool {
 	return false
 }
 
-func buildConfigFromFlags(context, kubeconfigPath string) (*rest.Config, error) {
-	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
-		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfigPath},
-		&clientcmd.ConfigOverrides{
-			CurrentContext: context,
-		}).ClientConfig()
-}
-
-func getConfig(kubeconfig, clusterContext, nameSpace string, localOnly bool) *rest.Config {
-	var config *rest.Config
-	if localOnly {
-		// creates the in-cluster config
-		config, err := rest.InClusterConfig()
-		if err != nil {
-			panic(err.Error())
-		}
-		return config
+func getConfig(kubeconfigPath, clusterContext, nameSpace string, manyNamespaces, localOnly bool) (*rest.Config, error) {
+	if manyNamespaces && nameSpace != "" {
+		return nil, errors.New("-namespace cannot be used together with -all-namespaces or -selector")
 	}
-	if kubeconfig == "" || clusterContext == "" || nameSpace == "" {
-		log.Fatalf("kubeconfig: %s, context: %s, and namespace: %s\n", kubeconfig, clusterContext, nameSpace)
+	if !localOnly && nameSpace == "" && !manyNamespaces {
+		return nil, fmt.Errorf("kubeconfig: %s, context: %s, and namespace: %s", kubeconfigPath, clusterContext, nameSpace)
 	}
-
-	// use the current context in kubeconfig
-	config, err := buildConfigFromFlags(clusterContext, kubeconfig)
-	if err != nil {
-		log.Fatalf("buidling config failed: %s", err.Error())
-	}
-	return config
+	return kubeconfig.Get(kubeconfigPath, clusterContext, localOnly)
 }
 
 func main() {
@@ -119,17 +201,34 @@ func main() {
 	var clusterContext *string
 	var nameSpace *string
 	var localOnly *bool
+	var reconstructInput *bool
+	var allNamespaces *bool
+	var selector *string
+	var concurrency *int
+	var compat *bool
 
 	localOnly = flag.Bool("local", false, "can bypass kubeconfig requirement if running within pod that has service account.")
 	kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
 	clusterContext = flag.String("context", "", "specify the context to use for the connection")
 	nameSpace = flag.String("namespace", "", "the namespace to query against")
+	allNamespaces = flag.Bool("all-namespaces", false, "if used, queries every namespace, printing the results keyed by namespace, beside the errors of any which could not be read")
+	selector = flag.String("selector", "", "if used, queries every namespace matching this label selector, such as env=prod, printing the results keyed by namespace, beside the errors of any which could not be read")
+	concurrency = flag.Int("concurrency", defaultConcurrency, "how many namespaces are queried at once with -all-namespaces or -selector")
+	compat = flag.Bool("compat", false, "if used, reports rolebindings as a flat list of subject names, and quotas as their hard limits alone, as older versions did")
+	reconstructInput = flag.Bool("reconstruct", false, "if used, prints the parser input most likely to have produced the namespace, and whatever does not fit it")
 
 	flag.Parse()
 
+	manyNamespaces := *allNamespaces || *selector != ""
+	if manyNamespaces && *reconstructInput {
+		log.Fatal("-reconstruct works on a single -namespace\n")
+	}
+
 	// get config corresponding to chosen flags
-	config := getConfig(*kubeconfig, *clusterContext, *nameSpace, *localOnly)
-	results := resultList{}
+	config, err := getConfig(*kubeconfig, *clusterContext, *nameSpace, manyNamespaces, *localOnly)
+	if err != nil {
+		log.Fatalf("%s\n", err.Error())
+	}
 
 	// create the clientsets
 	clientset, err := core.NewForConfig(config)
@@ -140,33 +239,65 @@ func main() {
 	if err != nil {
 		log.Fatalf("generate rbac client from config failed: %s", err.Error())
 	}
+	clientNetworking, err := networking.NewForConfig(config)
+	if err != nil {
+		log.Fatalf("generate networking client from config failed: %s", err.Error())
+	}
+	clientDynamic, err := dynamic.NewForConfig(config)
+	if err != nil {
+		log.Fatalf("generate dynamic client from config failed: %s", err.Error())
+	}
+	all := clients{core: clientset, rbac: clientRBAC, networking: clientNetworking, dynamic: clientDynamic}
 
 	// if the namespace is not present, find out now, and bail if not
-	namespaces, err := getNamespaceList(clientset)
+	namespaces, err := getNamespaceList(clientset, *selector)
 	if err != nil {
 		log.Fatalf("generate list of namespaces failed: %s", err.Error())
 	}
 
+	if manyNamespaces {
+		results, failures := getResultsFor(all, namespaces.NameSpaces, *concurrency)
+		output := namespaceResults{Namespaces: results, Errors: failures}
+		if *compat {
+			compatResults := make(map[string]compatResultList, len(results))
+			for namespace, result := range results {
+				compatResults[namespace] = result.compat()
+			}
+			output.Namespaces = compatResults
+		}
+		printJSON(output)
+		if len(failures) > 0 {
+			log.Fatalf("reading %d of %d namespaces failed\n", len(failures), len(namespaces.NameSpaces))
+		}
+		return
+	}
+
 	if !isNamespacePresent(*nameSpace, namespaces.NameSpaces) {
 		log.Fatal("supplied namespace not found\n")
 	}
 
-	// now grab the roleBinndings and resourceQuotas from this namespace
-	bindings, err := getRoleBindings(clientRBAC, *nameSpace)
-	if err != nil {
-		log.Fatalf("generate list of role bindings failed: %s", err.Error())
+	if *reconstructInput {
+		reconstructed, err := getReconstruction(clientRBAC, clientset, *nameSpace)
+		if err != nil {
+			log.Fatalf("reconstructing input failed: %s", err.Error())
+		}
+		printJSON(reconstructed)
+		return
 	}
 
-	results.RoleBindings = bindings.RoleBindings
-
-	quotas, err := getQuotas(clientset, *nameSpace)
+	results, err := getResults(all, *nameSpace)
 	if err != nil {
-		log.Fatalf("generate list of role bindings failed: %s", err.Error())
+		log.Fatalf("%s", err.Error())
 	}
+	if *compat {
+		printJSON(results.compat())
+		return
+	}
+	printJSON(results)
+}
 
-	results.Quotas = quotas.Quotas
-
-	resultString, err := json.Marshal(results)
+func printJSON(v interface{}) {
+	resultString, err := json.Marshal(v)
 	if err != nil {
 		log.Fatalf("failed to encode json due to error: %s", err.Error())
 	}
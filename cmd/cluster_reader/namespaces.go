@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+/*
+	With -all-namespaces, or -selector, the same results are gathered for many namespaces at once, keyed by namespace.
+	Namespaces are read by a fixed number of workers, so that thousands of them neither take forever, nor flood the
+	API server.
+
+	A namespace which cannot be read does not stop the rest: its error is reported alongside the results of those
+	which could be, unless it was deleted after being listed, in which case there is nothing left to report on.
+*/
+
+const defaultConcurrency = 10
+
+// returned by getResults for a namespace deleted since it was listed
+var errNamespaceGone = errors.New("namespace no longer exists")
+
+type namespaceResults struct {
+	Namespaces interface{}       `json:"namespaces"`
+	Errors     map[string]string `json:"errors"`
+}
+
+func getResults(c clients, namespace string) (resultList, error) {
+	results := resultList{}
+	var err error
+
+	results.Namespace, err = getNamespaceMetadata(c.core, namespace)
+	if apierrors.IsNotFound(err) {
+		return results, errNamespaceGone
+	}
+	if err != nil {
+		return results, fmt.Errorf("reading namespace failed: %s", err.Error())
+	}
+	if results.Project, err = getProject(c.dynamic, namespace); err != nil {
+		return results, fmt.Errorf("reading project failed: %s", err.Error())
+	}
+
+	// grab the roleBinndings and resourceQuotas from this namespace
+	bindings, err := getRoleBindings(c.rbac, namespace)
+	if err != nil {
+		return results, fmt.Errorf("generate list of role bindings failed: %s", err.Error())
+	}
+	results.RoleBindings = bindings.RoleBindings
+
+	quotas, err := getQuotas(c.core, namespace)
+	if err != nil {
+		return results, fmt.Errorf("generate list of quotas failed: %s", err.Error())
+	}
+	results.Quotas = quotas.Quotas
+
+	if results.LimitRanges, err = getLimitRanges(c.core, namespace); err != nil {
+		return results, fmt.Errorf("generate list of limit ranges failed: %s", err.Error())
+	}
+	if results.NetworkPolicies, err = getNetworkPolicies(c.networking, namespace); err != nil {
+		return results, fmt.Errorf("generate list of network policies failed: %s", err.Error())
+	}
+	if results.EgressNetworkPolicies, err = getEgressNetworkPolicies(c.dynamic, namespace); err != nil {
+		return results, fmt.Errorf("generate list of egress network policies failed: %s", err.Error())
+	}
+
+	return results, nil
+}
+
+func getResultsFor(c clients, namespaces []string, concurrency int) (map[string]resultList, map[string]string) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]resultList, len(namespaces))
+	failures := make(map[string]string)
+
+	work := make(chan string)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for namespace := range work {
+				result, err := getResults(c, namespace)
+				if err == errNamespaceGone {
+					continue
+				}
+				mutex.Lock()
+				if err != nil {
+					failures[namespace] = err.Error()
+				} else {
+					results[namespace] = result
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	for _, namespace := range namespaces {
+		work <- namespace
+	}
+	close(work)
+	wg.Wait()
+
+	return results, failures
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	coreTypes "k8s.io/api/core/v1"
+	networkingTypes "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	core "k8s.io/client-go/kubernetes/typed/core/v1"
+	networking "k8s.io/client-go/kubernetes/typed/networking/v1"
+)
+
+/*
+	Everything else the parser provisions. NetworkPolicies and LimitRanges are read through the typed clients, while
+	the OpenShift kinds, which client-go has no types for, are read through the dynamic client. On a cluster which
+	does not serve them, they are simply left out.
+*/
+
+var (
+	egressNetworkPolicyResource = schema.GroupVersionResource{Group: "network.openshift.io", Version: "v1", Resource: "egressnetworkpolicies"}
+	projectResource             = schema.GroupVersionResource{Group: "project.openshift.io", Version: "v1", Resource: "projects"}
+)
+
+type objectMetadata struct {
+	Name        string            `json:"name"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type networkPolicy struct {
+	Name string                            `json:"name"`
+	Spec networkingTypes.NetworkPolicySpec `json:"spec"`
+}
+
+type limitRange struct {
+	Name string                   `json:"name"`
+	Spec coreTypes.LimitRangeSpec `json:"spec"`
+}
+
+type egressNetworkPolicy struct {
+	Name string                 `json:"name"`
+	Spec map[string]interface{} `json:"spec"`
+}
+
+type project struct {
+	objectMetadata
+	Phase string `json:"phase,omitempty"`
+}
+
+func getNamespaceMetadata(client core.CoreV1Interface, namespace string) (objectMetadata, error) {
+	space, err := client.Namespaces().Get(namespace, metav1.GetOptions{})
+	if err != nil {
+		return objectMetadata{}, err
+	}
+	return objectMetadata{Name: space.Name, Labels: space.Labels, Annotations: space.Annotations}, nil
+}
+
+func getNetworkPolicies(client networking.NetworkingV1Interface, namespace string) ([]networkPolicy, error) {
+	var list []networkPolicy
+	policies, err := client.NetworkPolicies(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return list, err
+	}
+	for _, item := range policies.Items {
+		list = append(list, networkPolicy{Name: item.Name, Spec: item.Spec})
+	}
+	return list, nil
+}
+
+func getLimitRanges(client core.CoreV1Interface, namespace string) ([]limitRange, error) {
+	var list []limitRange
+	ranges, err := client.LimitRanges(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return list, err
+	}
+	for _, item := range ranges.Items {
+		list = append(list, limitRange{Name: item.Name, Spec: item.Spec})
+	}
+	return list, nil
+}
+
+func getEgressNetworkPolicies(client dynamic.Interface, namespace string) ([]egressNetworkPolicy, error) {
+	var list []egressNetworkPolicy
+	policies, err := client.Resource(egressNetworkPolicyResource).Namespace(namespace).List(metav1.ListOptions{})
+	if apierrors.IsNotFound(err) {
+		// not an OpenShift cluster
+		return list, nil
+	}
+	if err != nil {
+		return list, err
+	}
+	for _, item := range policies.Items {
+		spec, _ := item.Object["spec"].(map[string]interface{})
+		list = append(list, egressNetworkPolicy{Name: item.GetName(), Spec: spec})
+	}
+	return list, nil
+}
+
+func getProject(client dynamic.Interface, namespace string) (*project, error) {
+	item, err := client.Resource(projectResource).Get(namespace, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		// not an OpenShift cluster
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	p := &project{objectMetadata: objectMetadata{Name: item.GetName(), Labels: item.GetLabels(), Annotations: item.GetAnnotations()}}
+	if status, ok := item.Object["status"].(map[string]interface{}); ok {
+		p.Phase, _ = status["phase"].(string)
+	}
+	return p, nil
+}
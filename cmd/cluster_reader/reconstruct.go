@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	coreTypes "k8s.io/api/core/v1"
+	rbacTypes "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	core "k8s.io/client-go/kubernetes/typed/core/v1"
+	rbac "k8s.io/client-go/kubernetes/typed/rbac/v1"
+)
+
+/*
+	Projects created before the parser existed can be adopted by working out the input that would most likely have
+	produced them: the environment from the RES-<ENV>-OPSH- groups bound in the namespace, and the optionals from
+	the hard limits of its ResourceQuota. Whatever does not fit the parser's model is reported as a finding, rather
+	than guessed at, so that it can be looked at before the project is handed over.
+*/
+
+// matches the groups the rolebindings template binds, RES-<ENV>-OPSH-<ROLE>
+var groupPattern = regexp.MustCompile(`^RES-(.+?)-OPSH-(.+)$`)
+
+// the ClusterRole the rolebindings template binds each role's group to, by the start of the role
+var groupRoles = []struct {
+	prefix      string
+	clusterRole string
+}{
+	{"DEVELOPER-", "edit"},
+	{"VIEWER-", "view"},
+	{"DEPLOY-RELMAN", "admin"},
+	{"MANAGE-RELMAN", "deploy"},
+}
+
+// a quantity the parser can express as a count with an optional unit
+var quantityPattern = regexp.MustCompile(`^([0-9]+)(m|Ki|Mi|Gi|Ti|K|M|G|T)?$`)
+
+// the quota hard limits the parser's optionals end up as
+var quotaOptionals = map[coreTypes.ResourceName]string{
+	coreTypes.ResourceLimitsCPU:              "cpu",
+	coreTypes.ResourceLimitsMemory:           "memory",
+	coreTypes.ResourcePersistentVolumeClaims: "volumes",
+	coreTypes.ResourceRequestsStorage:        "storage",
+}
+
+type optional struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+	Unit  string `json:"unit,omitempty"`
+}
+
+// reconstructedInput has the same shape as the parser's expectedInput
+type reconstructedInput struct {
+	ProjectName string     `json:"projectname"`
+	Environment string     `json:"environment"`
+	Optionals   []optional `json:"optionals,omitempty"`
+}
+
+type reconstruction struct {
+	Input    reconstructedInput `json:"input"`
+	Findings []string           `json:"findings"`
+}
+
+func getReconstruction(clientRBAC rbac.RbacV1Interface, client core.CoreV1Interface, namespace string) (reconstruction, error) {
+	bindings, err := clientRBAC.RoleBindings(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return reconstruction{}, err
+	}
+	quotas, err := client.ResourceQuotas(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return reconstruction{}, err
+	}
+	return reconstruct(namespace, bindings.Items, quotas.Items), nil
+}
+
+func reconstruct(namespace string, bindings []rbacTypes.RoleBinding, quotas []coreTypes.ResourceQuota) reconstruction {
+	r := reconstruction{Input: reconstructedInput{ProjectName: namespace}, Findings: []string{}}
+	r.Input.Environment = r.environmentFrom(namespace, bindings)
+	r.Input.Optionals = r.optionalsFrom(quotas)
+	return r
+}
+
+func (r *reconstruction) report(format string, a ...interface{}) {
+	r.Findings = append(r.Findings, fmt.Sprintf(format, a...))
+}
+
+func (r *reconstruction) environmentFrom(namespace string, bindings []rbacTypes.RoleBinding) string {
+	// the developer and viewer groups end in the project's name, upper cased, with "-" replaced by "_"
+	suffix := "-" + strings.ToUpper(strings.Replace(namespace, "-", "_", -1))
+	counts := make(map[string]int)
+	for _, binding := range bindings {
+		// OpenShift's own bindings, such as system:image-pullers, are part of every project
+		if strings.HasPrefix(binding.Name, "system:") || strings.HasPrefix(binding.RoleRef.Name, "system:") {
+			continue
+		}
+		for _, subject := range binding.Subjects {
+			if subject.Kind != rbacTypes.GroupKind {
+				r.report("rolebinding %s binds %s %s directly, rather than through a group", binding.Name, subject.Kind, subject.Name)
+				continue
+			}
+			match := groupPattern.FindStringSubmatch(subject.Name)
+			if match == nil {
+				r.report("rolebinding %s binds group %s, which is not a RES-*-OPSH-* group", binding.Name, subject.Name)
+				continue
+			}
+			counts[strings.ToLower(match[1])]++
+			role := match[2]
+			projectRole := strings.HasPrefix(role, "DEVELOPER-") || strings.HasPrefix(role, "VIEWER-")
+			if projectRole && !strings.HasSuffix(role, suffix) {
+				r.report("rolebinding %s binds group %s, which belongs to another project", binding.Name, subject.Name)
+			}
+			r.checkRoleRef(binding, subject.Name, role)
+		}
+	}
+
+	if len(counts) == 0 {
+		r.report("no RES-*-OPSH-* groups are bound, so the environment is unknown")
+		return ""
+	}
+	var environments []string
+	for env := range counts {
+		environments = append(environments, env)
+	}
+	// the most bound environment wins, ties going to the first alphabetically
+	sort.Slice(environments, func(i, j int) bool {
+		if counts[environments[i]] != counts[environments[j]] {
+			return counts[environments[i]] > counts[environments[j]]
+		}
+		return environments[i] < environments[j]
+	})
+	if len(environments) > 1 {
+		r.report("groups from more than one environment are bound: %s, assuming %s", strings.Join(environments, ", "), environments[0])
+	}
+	return environments[0]
+}
+
+func (r *reconstruction) checkRoleRef(binding rbacTypes.RoleBinding, group, role string) {
+	bound := binding.RoleRef.Kind + " " + binding.RoleRef.Name
+	for _, expected := range groupRoles {
+		if strings.HasPrefix(role, expected.prefix) {
+			if bound != "ClusterRole "+expected.clusterRole {
+				r.report("rolebinding %s binds group %s to %s, rather than ClusterRole %s", binding.Name, group, bound, expected.clusterRole)
+			}
+			return
+		}
+	}
+	for _, expected := range groupRoles {
+		if bound == "ClusterRole "+expected.clusterRole {
+			return
+		}
+	}
+	r.report("rolebinding %s binds group %s to %s, which the parser never binds", binding.Name, group, bound)
+}
+
+func (r *reconstruction) optionalsFrom(quotas []coreTypes.ResourceQuota) []optional {
+	if len(quotas) == 0 {
+		r.report("no resourcequota found, so every optional is left to its default")
+		return nil
+	}
+	if len(quotas) > 1 {
+		var names []string
+		for _, quota := range quotas {
+			names = append(names, quota.Name)
+		}
+		r.report("more than one resourcequota found: %s, only %s is used", strings.Join(names, ", "), quotas[0].Name)
+	}
+	quota := quotas[0]
+
+	var resources []string
+	for resource := range quota.Spec.Hard {
+		resources = append(resources, string(resource))
+	}
+	sort.Strings(resources)
+
+	var optionals []optional
+	for _, resource := range resources {
+		quantity := quota.Spec.Hard[coreTypes.ResourceName(resource)]
+		name, ok := quotaOptionals[coreTypes.ResourceName(resource)]
+		if !ok {
+			r.report("resourcequota %s sets %s=%s, which no optional produces", quota.Name, resource, quantity.String())
+			continue
+		}
+		o, ok := toOptional(name, quantity.String())
+		if !ok {
+			r.report("resourcequota %s sets %s=%s, which cannot be expressed as the %s optional", quota.Name, resource, quantity.String(), name)
+			continue
+		}
+		optionals = append(optionals, o)
+	}
+	if len(quota.Spec.Scopes) > 0 || quota.Spec.ScopeSelector != nil {
+		r.report("resourcequota %s is scoped, which the parser never does", quota.Name)
+	}
+	return optionals
+}
+
+func toOptional(name, quantity string) (optional, bool) {
+	match := quantityPattern.FindStringSubmatch(quantity)
+	if match == nil {
+		return optional{}, false
+	}
+	count, err := strconv.Atoi(match[1])
+	if err != nil {
+		return optional{}, false
+	}
+	o := optional{Name: name, Count: count, Unit: match[2]}
+	switch name {
+	case "cpu":
+		// either whole cores, or millicores
+		return o, o.Unit == "" || o.Unit == "m"
+	case "volumes":
+		return o, o.Unit == ""
+	}
+	// memory and storage must have a unit, and cannot be fractions of a byte
+	return o, o.Unit != "" && o.Unit != "m"
+}
@@ -1,9 +1,30 @@
 package main
 
 import (
+	"crypto/ed25519"
+	"encoding/base64"
 	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 	"text/template"
+
+	coreTypes "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 func findObjectIndex(name string, files []string) (int, bool) {
@@ -16,7 +37,7 @@ func findObjectIndex(name string, files []string) (int, bool) {
 	return 0, false
 }
 
-func generateTemplate() *template.Template {
+func generateTemplate() (*template.Template, error) {
 	s := `
 		{{ $data := . }}
 	
@@ -53,8 +74,7 @@ func generateTemplate() *template.Template {
 		"upper":   upper,
 		"lower":   lower,
 	}
-	t := getTemplateFromString("raw_stream", s, funcMap)
-	return t
+	return getTemplateFromString("raw_stream", s, funcMap)
 }
 
 func TestCheckInputValid(t *testing.T) {
@@ -434,7 +454,7 @@ func TestValidName(t *testing.T) {
 
 func TestCreateNewProjectObject(t *testing.T) {
 
-	expectedBytes := []byte(`[{"content":{"apiVersion":"project.openshift.io/v1","kind":"Project","metadata":{"name":"boogie-test"}},"filename":"1-project.json"]`)
+	expectedBytes := []byte(`[{"content":{"apiVersion":"project.openshift.io/v1","kind":"Project","metadata":{"name":"boogie-test"}},"filename":"1-project.json"}]`)
 
 	i := expectedInput{ProjectName: "boogie-test"}
 	c := config{
@@ -468,7 +488,7 @@ func TestCreateNewProjectObject(t *testing.T) {
 
 func TestCreateNewNetworkPolicyObject(t *testing.T) {
 
-	expectedBytes := []byte(`[{"content":{"apiVersion":"networking.k8s.io/v1","kind":"NetworkPolicy","metadata":{"name":"default-deny-all","namespace":"boogie-test"},"spec":{"podSelector":{},"policyTypes":["Ingress"]}},"filename":"10-networkpolicy.json"]`)
+	expectedBytes := []byte(`[{"content":{"apiVersion":"networking.k8s.io/v1","kind":"NetworkPolicy","metadata":{"name":"default-deny-all","namespace":"boogie-test"},"spec":{"podSelector":{},"policyTypes":["Ingress"]}},"filename":"10-networkpolicy.json"}]`)
 
 	i := expectedInput{ProjectName: "boogie-test"}
 	c := config{
@@ -512,7 +532,7 @@ func TestCreateNewNetworkPolicyObject(t *testing.T) {
 
 func TestCreateNewEgressNetworkPolicyObject(t *testing.T) {
 
-	expectedBytes := []byte(`[{"content":{"apiVersion":"network.openshift.io/v1","kind":"EgressNetworkPolicy","metadata":{"name":"default-egress","namespace":"boogie-test"},"spec":{"egress":[{"to":{"cidrSelector":"0.0.0.0/0"},"type":"Deny"}]}},"filename":"10-egress-networkpolicy.json"]`)
+	expectedBytes := []byte(`[{"content":{"apiVersion":"network.openshift.io/v1","kind":"EgressNetworkPolicy","metadata":{"name":"default-egress","namespace":"boogie-test"},"spec":{"egress":[{"to":{"cidrSelector":"0.0.0.0/0"},"type":"Deny"}]}},"filename":"10-egress-networkpolicy.json"}]`)
 
 	i := expectedInput{ProjectName: "boogie-test"}
 	c := config{
@@ -558,7 +578,7 @@ func TestCreateNewEgressNetworkPolicyObject(t *testing.T) {
 
 func TestCreateNewRoleBindingObject(t *testing.T) {
 
-	expectedBytes := []byte(`[{"content":{"apiVersion":"rbac.authorization.k8s.io/v1","kind":"RoleBinding","metadata":{"name":"adgroup-edit-binding","namespace":"boogie-test"},"roleRef":{"apiGroup":"rbac.authorization.k8s.io","kind":"ClusterRole","name":"edit"},"subjects":[{"apiGroup":"rbac.authorization.k8s.io","kind":"Group","name":"RES--OPSH-DEVELOPER-BOOGIE_TEST"}]},"filename":"10-edit-group-rolebinding.json"},{"content":{"apiVersion":"rbac.authorization.k8s.io/v1","kind":"RoleBinding","metadata":{"name":"adgroup-view-binding","namespace":"boogie-test"},"roleRef":{"apiGroup":"rbac.authorization.k8s.io","kind":"ClusterRole","name":"view"},"subjects":[{"apiGroup":"rbac.authorization.k8s.io","kind":"Group","name":"RES--OPSH-VIEWER-BOOGIE_TEST"}]},"filename":"10-view-group-rolebinding.json"},{"content":{"apiVersion":"rbac.authorization.k8s.io/v1","kind":"RoleBinding","metadata":{"name":"adgroup-deploy-binding","namespace":"boogie-test"},"roleRef":{"apiGroup":"rbac.authorization.k8s.io","kind":"ClusterRole","name":"admin"},"subjects":[{"apiGroup":"rbac.authorization.k8s.io","kind":"Group","name":"RES--OPSH-DEPLOY-RELMAN"}]},"filename":"10-jenkins-rolebinding.json"},{"content":{"apiVersion":"rbac.authorization.k8s.io/v1","kind":"RoleBinding","metadata":{"name":"adgroup-manage-binding","namespace":"boogie-test"},"roleRef":{"apiGroup":"rbac.authorization.k8s.io","kind":"ClusterRole","name":"deploy"},"subjects":[{"apiGroup":"rbac.authorization.k8s.io","kind":"Group","name":"RES--OPSH-MANAGE-RELMAN"}]},"filename":"10-default-rolebinding.json"]`)
+	expectedBytes := []byte(`[{"content":{"apiVersion":"rbac.authorization.k8s.io/v1","kind":"RoleBinding","metadata":{"name":"adgroup-edit-binding","namespace":"boogie-test"},"roleRef":{"apiGroup":"rbac.authorization.k8s.io","kind":"ClusterRole","name":"edit"},"subjects":[{"apiGroup":"rbac.authorization.k8s.io","kind":"Group","name":"RES--OPSH-DEVELOPER-BOOGIE_TEST"}]},"filename":"10-edit-group-rolebinding.json"},{"content":{"apiVersion":"rbac.authorization.k8s.io/v1","kind":"RoleBinding","metadata":{"name":"adgroup-view-binding","namespace":"boogie-test"},"roleRef":{"apiGroup":"rbac.authorization.k8s.io","kind":"ClusterRole","name":"view"},"subjects":[{"apiGroup":"rbac.authorization.k8s.io","kind":"Group","name":"RES--OPSH-VIEWER-BOOGIE_TEST"}]},"filename":"10-view-group-rolebinding.json"},{"content":{"apiVersion":"rbac.authorization.k8s.io/v1","kind":"RoleBinding","metadata":{"name":"adgroup-deploy-binding","namespace":"boogie-test"},"roleRef":{"apiGroup":"rbac.authorization.k8s.io","kind":"ClusterRole","name":"admin"},"subjects":[{"apiGroup":"rbac.authorization.k8s.io","kind":"Group","name":"RES--OPSH-DEPLOY-RELMAN"}]},"filename":"10-jenkins-rolebinding.json"},{"content":{"apiVersion":"rbac.authorization.k8s.io/v1","kind":"RoleBinding","metadata":{"name":"adgroup-manage-binding","namespace":"boogie-test"},"roleRef":{"apiGroup":"rbac.authorization.k8s.io","kind":"ClusterRole","name":"deploy"},"subjects":[{"apiGroup":"rbac.authorization.k8s.io","kind":"Group","name":"RES--OPSH-MANAGE-RELMAN"}]},"filename":"10-default-rolebinding.json"}]`)
 
 	i := expectedInput{ProjectName: "boogie-test"}
 	c := config{
@@ -677,7 +697,7 @@ func TestCreateNewRoleBindingObject(t *testing.T) {
 }
 
 func TestCreateNewLimitsObject(t *testing.T) {
-	expectedBytes := []byte(`[{"content":{"apiVersion":"v1","kind":"ResourceQuota","metadata":{"name":"default-quotas","namespace":"boogie-test"},"spec":{"hard":{"limits.cpu":2,"limits.memory":"1Gi","persistentvolumeclaims":3,"requests.storage":"100Gi"}}},"filename":"10-quotas.json"]`)
+	expectedBytes := []byte(`[{"content":{"apiVersion":"v1","kind":"ResourceQuota","metadata":{"name":"default-quotas","namespace":"boogie-test"},"spec":{"hard":{"limits.cpu":2,"limits.memory":"1Gi","persistentvolumeclaims":3,"requests.storage":"100Gi"}}},"filename":"10-quotas.json"}]`)
 
 	o := []optionalObject{
 		optionalObject{
@@ -746,7 +766,7 @@ func TestCreateNewLimitsObject(t *testing.T) {
 		t.Errorf("wanted \n%s, \nbut got \n%s \n", expectedBytes, gotBytes)
 	}
 
-	expectedBytes = []byte(`[{"content":{"apiVersion":"v1","kind":"ResourceQuota","metadata":{"name":"default-quotas","namespace":"boogie-test"},"spec":{"hard":{"limits.cpu":1,"limits.memory":"5Gi","persistentvolumeclaims":1,"requests.storage":"5Gi"}}},"filename":"10-quotas.json"]`)
+	expectedBytes = []byte(`[{"content":{"apiVersion":"v1","kind":"ResourceQuota","metadata":{"name":"default-quotas","namespace":"boogie-test"},"spec":{"hard":{"limits.cpu":1,"limits.memory":"5Gi","persistentvolumeclaims":1,"requests.storage":"5Gi"}}},"filename":"10-quotas.json"}]`)
 
 	o = []optionalObject{
 		optionalObject{
@@ -793,7 +813,7 @@ func TestCreateNewLimitsObject(t *testing.T) {
 }
 
 func TestCreateNewLimitsObjectCPU(t *testing.T) {
-	expectedBytes := []byte(`[{"content":{"apiVersion":"v1","kind":"ResourceQuota","metadata":{"name":"default-quotas","namespace":"boogie-test"},"spec":{"hard":{"limits.cpu":"200m","limits.memory":"1Gi","persistentvolumeclaims":3,"requests.storage":"1Gi"}}},"filename":"10-quotas.json"]`)
+	expectedBytes := []byte(`[{"content":{"apiVersion":"v1","kind":"ResourceQuota","metadata":{"name":"default-quotas","namespace":"boogie-test"},"spec":{"hard":{"limits.cpu":"200m","limits.memory":"1Gi","persistentvolumeclaims":3,"requests.storage":"1Gi"}}},"filename":"10-quotas.json"}]`)
 
 	o := []optionalObject{
 		optionalObject{
@@ -862,7 +882,7 @@ func TestCreateNewLimitsObjectCPU(t *testing.T) {
 }
 
 func TestShowDefaultQuotas(t *testing.T) {
-	expectedBytes := []byte(`[{"content":{"apiVersion":"v1","kind":"ResourceQuota","metadata":{"name":"default-quotas","namespace":"show-only"},"spec":{"hard":{"limits.cpu":"100m","limits.memory":"100Mi","persistentvolumeclaims":1,"requests.storage":"1Gi"}}},"filename":"10-quotas.json"]`)
+	expectedBytes := []byte(`[{"content":{"apiVersion":"v1","kind":"ResourceQuota","metadata":{"name":"default-quotas","namespace":"show-only"},"spec":{"hard":{"limits.cpu":"100m","limits.memory":"100Mi","persistentvolumeclaims":1,"requests.storage":"1Gi"}}},"filename":"10-quotas.json"}]`)
 
 	c := config{
 		flatOutput:          true,
@@ -911,3 +931,1334 @@ func TestShowDefaultQuotas(t *testing.T) {
 	}
 
 }
+
+func TestTemplateErrorsAreReturned(t *testing.T) {
+
+	i := expectedInput{ProjectName: "boogie-test"}
+
+	// a broken template must not exit the process, but report which template failed
+	c := config{
+		flatOutput:          true,
+		usefileContentInput: true,
+		fileContent:         `[{"filename": "{{ .ProjectName "}]`,
+	}
+	_, err := c.process(&i)
+	if err == nil {
+		t.Fatalf("wanted %s, but got %s: \n", "an error", "nil")
+	}
+	if !strings.Contains(err.Error(), "raw_stream") {
+		t.Errorf("wanted error naming %s, but got %s: \n", "raw_stream", err.Error())
+	}
+
+	// executing against a missing field must also be reported
+	c.fileContent = `[{"filename": "{{ .Missing }}"}]`
+	_, err = c.process(&i)
+	if err == nil {
+		t.Fatalf("wanted %s, but got %s: \n", "an error", "nil")
+	}
+	if !strings.HasPrefix(err.Error(), "error in executing template raw_stream") {
+		t.Errorf("wanted %s, but got %s: \n", "error in executing template raw_stream", err.Error())
+	}
+}
+
+func TestInvalidJSONReportsPosition(t *testing.T) {
+
+	i := expectedInput{ProjectName: "boogie-test"}
+	c := config{
+		flatOutput:          true,
+		usefileContentInput: true,
+		fileContent: `[{
+	"filename": "1-project.json",
+	"content": {
+		"kind": "Project"
+		"apiVersion": "project.openshift.io/v1"
+	}
+}]`,
+	}
+	_, err := c.process(&i)
+	if err == nil {
+		t.Fatalf("wanted %s, but got %s: \n", "an error", "nil")
+	}
+	rerr, ok := err.(*renderError)
+	if !ok {
+		t.Fatalf("wanted %s, but got %T: \n", "*renderError", err)
+	}
+	if rerr.template != "raw_stream" || rerr.line != 5 || rerr.column != 3 {
+		t.Errorf("wanted %s, but got %s:%d:%d: \n", "raw_stream:5:3", rerr.template, rerr.line, rerr.column)
+	}
+	if !strings.Contains(rerr.snippet, `"apiVersion": "project.openshift.io/v1"`) {
+		t.Errorf("wanted snippet containing the offending line, but got \n%s \n", rerr.snippet)
+	}
+}
+
+func TestEnvelopeIsValidated(t *testing.T) {
+
+	i := expectedInput{ProjectName: "boogie-test"}
+	c := config{
+		flatOutput:          true,
+		usefileContentInput: true,
+	}
+
+	tests := []struct {
+		fileContent string
+		want        string
+	}{
+		{
+			fileContent: `{"filename": "1-project.json", "content": {}}`,
+			want:        "template raw_stream must render a json array of {filename, content} objects, but rendered an object",
+		},
+		{
+			fileContent: `[{"content": {"kind": "Project", "apiVersion": "project.openshift.io/v1", "metadata": {"name": "{{ .ProjectName }}"}}}]`,
+			want:        "template raw_stream, entry 0: filename is required",
+		},
+		{
+			fileContent: `[{"filename": "1-project.json", "file": "x", "content": {}}]`,
+			want:        `template raw_stream, entry 0: unexpected field "file", only filename and content are allowed`,
+		},
+		{
+			fileContent: `[{"filename": "1-project.json", "content": {"apiVersion": "project.openshift.io/v1", "metadata": {"name": "{{ .ProjectName }}"}}}]`,
+			want:        "template raw_stream, entry 0: 1-project.json: content.kind is required",
+		},
+		{
+			fileContent: `[{"filename": "10-quotas.json", "content": {"kind": "ResourceQuota", "apiVersion": "v1", "metadata": {"name": "default-quotas"}}}]`,
+			want:        "template raw_stream, entry 0: 10-quotas.json: content.metadata.namespace is required for namespaced kind ResourceQuota",
+		},
+		{
+			fileContent: `[{"filename": "1-project.json", "content": {"kind": "Project", "apiVersion": "project.openshift.io/v1", "metadata": {"name": "{{ .ProjectName }}", "namespace": "{{ .ProjectName }}"}}}]`,
+			want:        "template raw_stream, entry 0: 1-project.json: content.metadata.namespace must not be set for cluster scoped kind Project",
+		},
+	}
+
+	for _, test := range tests {
+		c.fileContent = test.fileContent
+		_, err := c.process(&i)
+		if err == nil {
+			t.Errorf("wanted %s, but got %s: \n", test.want, "nil")
+			continue
+		}
+		if err.Error() != test.want {
+			t.Errorf("wanted %s, but got %s: \n", test.want, err.Error())
+		}
+	}
+}
+
+func TestGeneratedObjectsAreStrictlyTyped(t *testing.T) {
+
+	i := expectedInput{ProjectName: "boogie-test"}
+	c := config{
+		flatOutput:          true,
+		usefileContentInput: true,
+	}
+
+	tests := []struct {
+		fileContent string
+		want        string
+	}{
+		{
+			fileContent: `[{"filename": "10-networkpolicy.json", "content": {"apiVersion": "networking.k8s.io/v1", "kind": "NetworkPolicy", "metadata": {"name": "default-deny-all", "namespace": "{{ .ProjectName }}"}, "spec": {"podSelector": {}, "polcyTypes": ["Ingress"]}}}]`,
+			want:        "found unknown field: polcyTypes",
+		},
+		{
+			fileContent: `[{"filename": "10-quotas.json", "content": {"apiVersion": "v1", "kind": "ResourceQuota", "metadata": {"name": "default-quotas", "namespace": "{{ .ProjectName }}"}, "spec": {"hard": "lots"}}}]`,
+			want:        "template raw_stream: 10-quotas.json: ",
+		},
+		{
+			fileContent: `[{"filename": "10-egress-networkpolicy.json", "content": {"apiVersion": "network.openshift.io/v1", "kind": "EgressNetworkPolicy", "metadata": {"name": "default-egress", "namespace": "{{ .ProjectName }}"}, "spec": {"egress": [{"type": "Deny", "to": {"cidr": "0.0.0.0/0"}}]}}}]`,
+			want:        "found unknown field: cidr",
+		},
+		{
+			fileContent: `[{"filename": "10-widget.json", "content": {"apiVersion": "example.com/v1", "kind": "Widget", "metadata": {"name": "widget", "namespace": "{{ .ProjectName }}"}}}]`,
+			want:        `template raw_stream: 10-widget.json: no kind "Widget" is registered for version "example.com/v1" in scheme`,
+		},
+	}
+
+	for _, test := range tests {
+		c.fileContent = test.fileContent
+		_, err := c.process(&i)
+		if err == nil {
+			t.Errorf("wanted %s, but got %s: \n", test.want, "nil")
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), "template raw_stream: ") || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("wanted %s, but got %s: \n", test.want, err.Error())
+		}
+	}
+
+	// unregistered kinds are let through when asked to
+	c.allowUnregisteredKinds = true
+	c.fileContent = tests[3].fileContent
+	if _, err := c.process(&i); err != nil {
+		t.Errorf("wanted \n%s, \nbut got \n%s \n", "no error", err.Error())
+	}
+}
+
+func writeTemplates(t *testing.T, templates map[string]string) string {
+	// writes each template into a fresh directory, returning the directory with a trailing "/" as getConfig does
+	dir, err := ioutil.TempDir("", "templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range templates {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir + "/"
+}
+
+func TestCollisionsAcrossTemplates(t *testing.T) {
+
+	quotas := `[{"filename": "10-quotas.json", "content": {"kind": "ResourceQuota", "apiVersion": "v1", "metadata": {"name": "default-quotas", "namespace": "{{ .ProjectName }}"}}}]`
+	moreQuotas := `[{"filename": "10-quotas.json", "content": {"kind": "ResourceQuota", "apiVersion": "v1", "metadata": {"name": "default-quotas", "namespace": "{{ .ProjectName }}"}}}]`
+	otherQuotas := `[{"filename": "20-quotas.json", "content": {"kind": "ResourceQuota", "apiVersion": "v1", "metadata": {"name": "other-quotas", "namespace": "{{ .ProjectName }}"}}}]`
+
+	dir := writeTemplates(t, map[string]string{
+		"quotas.txt.tmpl":       quotas,
+		"more-quotas.txt.tmpl":  moreQuotas,
+		"other-quotas.txt.tmpl": otherQuotas,
+	})
+	defer os.RemoveAll(dir)
+
+	i := expectedInput{ProjectName: "boogie-test"}
+	c := config{
+		flatOutput:  true,
+		templateDir: dir,
+		fileList:    []string{"quotas.txt.tmpl", "other-quotas.txt.tmpl", "more-quotas.txt.tmpl"},
+	}
+	_, err := c.process(&i)
+	if err == nil {
+		t.Fatalf("wanted %s, but got %s: \n", "an error", "nil")
+	}
+	want := `templates produce colliding output:
+  filename 10-quotas.json is produced by templates quotas.txt.tmpl and more-quotas.txt.tmpl
+  object v1/ResourceQuota boogie-test/default-quotas is produced by templates quotas.txt.tmpl and more-quotas.txt.tmpl`
+	if err.Error() != want {
+		t.Errorf("wanted \n%s, \nbut got \n%s \n", want, err.Error())
+	}
+
+	// distinct templates are fine together
+	c.fileList = []string{"quotas.txt.tmpl", "other-quotas.txt.tmpl"}
+	if _, err := c.process(&i); err != nil {
+		t.Errorf("wanted \n%s, \nbut got \n%s \n", "no error", err.Error())
+	}
+}
+
+func TestMultipleTemplatesProduceValidJSON(t *testing.T) {
+
+	project := `[{"filename": "1-project.json", "content": {"kind": "Project", "apiVersion": "project.openshift.io/v1", "metadata": {"name": "{{ .ProjectName }}"}}}]`
+	quotas := `[{"filename": "10-quotas.json", "content": {"kind": "ResourceQuota", "apiVersion": "v1", "metadata": {"name": "default-quotas", "namespace": "{{ .ProjectName }}"}}}]
+
+`
+	dir := writeTemplates(t, map[string]string{
+		"project.txt.tmpl": project,
+		"quotas.txt.tmpl":  quotas,
+	})
+	defer os.RemoveAll(dir)
+
+	expectedBytes := []byte(`[{"content":{"apiVersion":"project.openshift.io/v1","kind":"Project","metadata":{"name":"boogie-test"}},"filename":"1-project.json"},{"content":{"apiVersion":"v1","kind":"ResourceQuota","metadata":{"name":"default-quotas","namespace":"boogie-test"}},"filename":"10-quotas.json"}]`)
+
+	i := expectedInput{ProjectName: "boogie-test"}
+	c := config{
+		flatOutput:  true,
+		templateDir: dir,
+		fileList:    []string{"project.txt.tmpl", "quotas.txt.tmpl"},
+	}
+	gotBytes, err := c.process(&i)
+	if err != nil {
+		t.Fatalf("wanted \n%s, \nbut got \n%s \n", "no error", err.Error())
+	}
+	if string(expectedBytes) != string(gotBytes) {
+		t.Errorf("wanted \n%s, \nbut got \n%s \n", expectedBytes, gotBytes)
+	}
+
+	// the indented form must decode to the same thing
+	c.flatOutput = false
+	gotBytes, err = c.show()
+	if err != nil {
+		t.Fatalf("wanted \n%s, \nbut got \n%s \n", "no error", err.Error())
+	}
+	var files []GeneratedFile
+	if err := json.Unmarshal(gotBytes, &files); err != nil {
+		t.Fatalf("wanted \n%s, \nbut got \n%s \n", "valid json", err.Error())
+	}
+	if len(files) != 2 || files[1].Filename != "10-quotas.json" {
+		t.Errorf("wanted %s, but got %v: \n", "both files", files)
+	}
+}
+
+func TestWriteDir(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := GeneratedFiles{
+		{Filename: "1-project.json", Content: map[string]interface{}{"kind": "Project"}, SourceTemplate: "project.txt.tmpl"},
+		{Filename: "quotas/10-quotas.json", Content: map[string]interface{}{"kind": "ResourceQuota"}, SourceTemplate: "quotas.txt.tmpl"},
+	}
+
+	result, err := files.writeDir(dir, existingFail, true)
+	if err != nil {
+		t.Fatalf("wanted \n%s, \nbut got \n%s \n", "no error", err.Error())
+	}
+	if len(result.Written) != 2 {
+		t.Errorf("wanted %d, but got %d: \n", 2, len(result.Written))
+	}
+	got, err := ioutil.ReadFile(filepath.Join(dir, "quotas", "10-quotas.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "{\"kind\":\"ResourceQuota\"}\n" {
+		t.Errorf("wanted %s, but got %s: \n", `{"kind":"ResourceQuota"}`, got)
+	}
+
+	// a second run must refuse, and leave nothing behind
+	_, err = files.writeDir(dir, existingFail, true)
+	if err == nil || err.Error() != "refusing to overwrite existing files: 1-project.json, quotas/10-quotas.json" {
+		t.Errorf("wanted %s, but got %v: \n", "refusing to overwrite existing files", err)
+	}
+	entries, _ := ioutil.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("wanted %d, but got %d: \n", 2, len(entries))
+	}
+
+	result, err = files.writeDir(dir, existingSkip, true)
+	if err != nil || len(result.Skipped) != 2 || len(result.Written) != 0 {
+		t.Errorf("wanted %s, but got %v %v: \n", "both skipped", result, err)
+	}
+
+	result, err = files.writeDir(dir, existingOverwrite, true)
+	if err != nil || len(result.Written) != 2 {
+		t.Errorf("wanted %s, but got %v %v: \n", "both written", result, err)
+	}
+
+	// a failure part way through leaves the directory as it was, other files included
+	if err := ioutil.WriteFile(filepath.Join(dir, "notes.txt"), []byte("mine"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	broken := GeneratedFiles{
+		{Filename: "1-project.json", Content: map[string]interface{}{"kind": "Changed"}, SourceTemplate: "project.txt.tmpl"},
+		{Filename: "20-broken.json", Content: map[string]interface{}{"kind": make(chan int)}, SourceTemplate: "broken.txt.tmpl"},
+	}
+	if _, err := broken.writeDir(dir, existingOverwrite, true); err == nil {
+		t.Errorf("wanted %s, but got %s: \n", "an error", "nil")
+	}
+	got, _ = ioutil.ReadFile(filepath.Join(dir, "1-project.json"))
+	if string(got) != "{\"kind\":\"Project\"}\n" {
+		t.Errorf("wanted %s, but got %s: \n", `{"kind":"Project"}`, got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "20-broken.json")); err == nil {
+		t.Errorf("wanted %s, but got %s: \n", "no 20-broken.json", "one")
+	}
+	result, err = broken[:1].writeDir(dir, existingOverwrite, true)
+	if err != nil || len(result.Written) != 1 {
+		t.Errorf("wanted %s, but got %v %v: \n", "one written", result, err)
+	}
+	got, _ = ioutil.ReadFile(filepath.Join(dir, "notes.txt"))
+	if string(got) != "mine" {
+		t.Errorf("wanted %s, but got %s: \n", "mine", got)
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(dir, ".*.tmp-*"))
+	if len(leftovers) != 0 {
+		t.Errorf("wanted %s, but got %v: \n", "no staged files left", leftovers)
+	}
+
+	// the directory is written into, not replaced, so a symlink to it stays one
+	link := dir + "-link"
+	if err := os.Symlink(dir, link); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(link)
+	more := GeneratedFiles{{Filename: "30-more.json", Content: map[string]interface{}{"kind": "More"}, SourceTemplate: "more.txt.tmpl"}}
+	if _, err := more.writeDir(link, existingFail, true); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("wanted %s, but got %v: \n", "the symlink left in place", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "30-more.json")); err != nil {
+		t.Errorf("wanted %s, but got %s: \n", "30-more.json in the symlink's target", err.Error())
+	}
+
+	// nothing may escape the output directory
+	for _, name := range []string{"../escape.json", "/etc/escape.json", "a/../../escape.json", ".."} {
+		bad := GeneratedFiles{{Filename: name, Content: map[string]interface{}{}, SourceTemplate: "bad.txt.tmpl"}}
+		if _, err := bad.writeDir(dir, existingOverwrite, true); err == nil {
+			t.Errorf("wanted %s, but got %s: \n", "an error for "+name, "nil")
+		}
+	}
+}
+
+func TestListOutput(t *testing.T) {
+
+	files := GeneratedFiles{
+		{Filename: "10-quotas.json", Content: map[string]interface{}{"apiVersion": "v1", "kind": "ResourceQuota"}},
+		{Filename: "5-clusterrole.json", Content: map[string]interface{}{"apiVersion": "rbac.authorization.k8s.io/v1", "kind": "ClusterRole"}},
+		{Filename: "1-project.json", Content: map[string]interface{}{"apiVersion": "project.openshift.io/v1", "kind": "Project"}},
+		{Filename: "10-networkpolicy.json", Content: map[string]interface{}{"apiVersion": "networking.k8s.io/v1", "kind": "NetworkPolicy"}},
+	}
+
+	expectedBytes := []byte(`{"apiVersion":"v1","kind":"List","metadata":{},"items":[{"apiVersion":"project.openshift.io/v1","kind":"Project"},{"apiVersion":"rbac.authorization.k8s.io/v1","kind":"ClusterRole"},{"apiVersion":"v1","kind":"ResourceQuota"},{"apiVersion":"networking.k8s.io/v1","kind":"NetworkPolicy"}]}`)
+	gotBytes, err := files.serialize(outputList, true)
+	if err != nil {
+		t.Fatalf("wanted \n%s, \nbut got \n%s \n", "no error", err.Error())
+	}
+	if string(expectedBytes) != string(gotBytes) {
+		t.Errorf("wanted \n%s, \nbut got \n%s \n", expectedBytes, gotBytes)
+	}
+
+	// ordering for output must not disturb the bundle itself
+	if files[0].Filename != "10-quotas.json" {
+		t.Errorf("wanted %s, but got %s: \n", "10-quotas.json", files[0].Filename)
+	}
+
+	if _, err := files.serialize("xml", true); err == nil {
+		t.Errorf("wanted %s, but got %s: \n", "an error", "nil")
+	}
+}
+
+func TestYAMLOutput(t *testing.T) {
+
+	files := GeneratedFiles{
+		{Filename: "10-quotas.json", SourceTemplate: "quotas.txt.tmpl", Content: map[string]interface{}{"kind": "ResourceQuota", "apiVersion": "v1", "metadata": map[string]interface{}{"namespace": "boogie-test", "name": "default-quotas"}}},
+		{Filename: "1-project.json", SourceTemplate: "project.txt.tmpl", Content: map[string]interface{}{"kind": "Project", "apiVersion": "project.openshift.io/v1", "metadata": map[string]interface{}{"name": "boogie-test"}}},
+	}
+
+	expected := `---
+# filename: 1-project.json
+# source: project.txt.tmpl
+apiVersion: project.openshift.io/v1
+kind: Project
+metadata:
+  name: boogie-test
+---
+# filename: 10-quotas.json
+# source: quotas.txt.tmpl
+apiVersion: v1
+kind: ResourceQuota
+metadata:
+  name: default-quotas
+  namespace: boogie-test
+`
+	gotBytes, err := files.serialize(outputYAML, false)
+	if err != nil {
+		t.Fatalf("wanted \n%s, \nbut got \n%s \n", "no error", err.Error())
+	}
+	if expected != string(gotBytes) {
+		t.Errorf("wanted \n%s, \nbut got \n%s \n", expected, gotBytes)
+	}
+}
+
+func TestWriteKustomize(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "kustomize")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := expectedInput{ProjectName: "boogie-test", Environment: "dev"}
+	files := GeneratedFiles{
+		{Filename: "10-quotas.json", SourceTemplate: "quotas.txt.tmpl", Content: map[string]interface{}{"kind": "ResourceQuota"}},
+		{Filename: "1-project.json", SourceTemplate: "project.txt.tmpl", Content: map[string]interface{}{"kind": "Project"}},
+	}
+
+	_, err = files.writeKustomize(dir, &data, []string{"dev"}, existingFail, true)
+	if err != nil {
+		t.Fatalf("wanted \n%s, \nbut got \n%s \n", "no error", err.Error())
+	}
+
+	expected := `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+labels:
+- includeSelectors: false
+  pairs:
+    app.kubernetes.io/managed-by: gobins-parser
+    gobins.io/environment: dev
+    gobins.io/project: boogie-test
+namespace: boogie-test
+resources:
+- 1-project.json
+- 10-quotas.json
+`
+	got, err := ioutil.ReadFile(filepath.Join(dir, "boogie-test", "base", "kustomization.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != expected {
+		t.Errorf("wanted \n%s, \nbut got \n%s \n", expected, got)
+	}
+
+	// hand edited overlays survive regeneration
+	overlay := filepath.Join(dir, "boogie-test", "overlays", "dev", "kustomization.yaml")
+	if err := ioutil.WriteFile(overlay, []byte("edited"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := files.writeKustomize(dir, &data, []string{"dev"}, existingOverwrite, true)
+	if err != nil {
+		t.Fatalf("wanted \n%s, \nbut got \n%s \n", "no error", err.Error())
+	}
+	if len(result.Skipped) != 1 || result.Skipped[0] != "overlays/dev/kustomization.yaml" {
+		t.Errorf("wanted %s, but got %v: \n", "overlays/dev/kustomization.yaml skipped", result.Skipped)
+	}
+	got, _ = ioutil.ReadFile(overlay)
+	if string(got) != "edited" {
+		t.Errorf("wanted %s, but got %s: \n", "edited", got)
+	}
+}
+
+func TestCommitToGit(t *testing.T) {
+
+	if _, err := exec.LookPath("git"); err != nil {
+		// the image build sets GOBINS_REQUIRE_GIT, so that this never quietly goes untested there
+		if os.Getenv("GOBINS_REQUIRE_GIT") != "" {
+			t.Fatal("git not available, but GOBINS_REQUIRE_GIT is set")
+		}
+		t.Skip("git not available")
+	}
+	repo, err := ioutil.TempDir("", "repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repo)
+	if out, err := exec.Command("git", "init", "-q", "--bare", repo).CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %s", out)
+	}
+
+	data := expectedInput{ProjectName: "boogie-test", Environment: "dev"}
+	files := GeneratedFiles{
+		{Filename: "1-project.json", SourceTemplate: "project.txt.tmpl", Content: map[string]interface{}{"kind": "Project"}},
+	}
+	target := gitTarget{repo: repo, branch: defaultGitBranch, path: defaultGitPath, author: "Test <test@example.com>"}
+
+	result, err := files.commitToGit(target, &data, true)
+	if err != nil {
+		t.Fatalf("wanted \n%s, \nbut got \n%s \n", "no error", err.Error())
+	}
+	if !result.Changed || result.Branch != "parser/boogie-test" || result.Path != "dev/boogie-test" {
+		t.Errorf("wanted %s, but got %v: \n", "a commit on parser/boogie-test", result)
+	}
+
+	got, err := exec.Command("git", "-C", repo, "show", "parser/boogie-test:dev/boogie-test/1-project.json").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "{\"kind\":\"Project\"}\n" {
+		t.Errorf("wanted %s, but got %s: \n", `{"kind":"Project"}`, got)
+	}
+	message, _ := exec.Command("git", "-C", repo, "log", "-1", "--format=%an <%ae> %B", "parser/boogie-test").Output()
+	if !strings.Contains(string(message), "Test <test@example.com>") || !strings.Contains(string(message), "sha256:"+data.hash()) {
+		t.Errorf("wanted %s, but got %s: \n", "author and input hash", message)
+	}
+
+	// the same bundle again changes nothing
+	again, err := files.commitToGit(target, &data, true)
+	if err != nil {
+		t.Fatalf("wanted \n%s, \nbut got \n%s \n", "no error", err.Error())
+	}
+	if again.Changed || again.Commit != result.Commit {
+		t.Errorf("wanted %s, but got %v: \n", "no change", again)
+	}
+
+	// files which are no longer generated are removed
+	files[0].Filename = "2-project.json"
+	if _, err := files.commitToGit(target, &data, true); err != nil {
+		t.Fatalf("wanted \n%s, \nbut got \n%s \n", "no error", err.Error())
+	}
+	listing, _ := exec.Command("git", "-C", repo, "ls-tree", "-r", "--name-only", "parser/boogie-test").Output()
+	if string(listing) != "dev/boogie-test/2-project.json\n" {
+		t.Errorf("wanted %s, but got %s: \n", "dev/boogie-test/2-project.json", listing)
+	}
+
+	// a new branch is created even when HEAD already has the same bundle
+	if out, err := exec.Command("git", "-C", repo, "symbolic-ref", "HEAD", "refs/heads/parser/boogie-test").CombinedOutput(); err != nil {
+		t.Fatalf("git symbolic-ref failed: %s", out)
+	}
+	head, _ := exec.Command("git", "-C", repo, "rev-parse", "HEAD").Output()
+	copied := target
+	copied.branch = "copy/{{.ProjectName}}"
+	result, err = files.commitToGit(copied, &data, true)
+	if err != nil {
+		t.Fatalf("wanted \n%s, \nbut got \n%s \n", "no error", err.Error())
+	}
+	branch, _ := exec.Command("git", "-C", repo, "rev-parse", "copy/boogie-test").Output()
+	if result.Changed || result.Commit != strings.TrimSpace(string(head)) || string(branch) != string(head) {
+		t.Errorf("wanted %s, but got %v, branch at %s: \n", "copy/boogie-test at "+string(head), result, branch)
+	}
+
+	// sha256 repositories need a longer null id
+	repo256, err := ioutil.TempDir("", "repo256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repo256)
+	if err := exec.Command("git", "init", "-q", "--bare", "--object-format=sha256", repo256).Run(); err != nil {
+		return
+	}
+	target.repo = repo256
+	for _, filename := range []string{"1-project.json", "2-project.json"} {
+		files[0].Filename = filename
+		if _, err := files.commitToGit(target, &data, true); err != nil {
+			t.Fatalf("wanted \n%s, \nbut got \n%s \n", "no error", err.Error())
+		}
+	}
+	listing, _ = exec.Command("git", "-C", repo256, "ls-tree", "-r", "--name-only", "parser/boogie-test").Output()
+	if string(listing) != "dev/boogie-test/2-project.json\n" {
+		t.Errorf("wanted %s, but got %s: \n", "dev/boogie-test/2-project.json", listing)
+	}
+}
+
+func TestInputHashIsNormalized(t *testing.T) {
+
+	a := expectedInput{}
+	b := expectedInput{}
+	if err := json.Unmarshal([]byte(`{"projectname":"Boogie-Test","environment":"DEV","optionals":[{"name":"cpu","count":1},{"name":"volumes","count":2}]}`), &a); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(`{"environment":"dev","projectname":"boogie-test","optionals":[{"name":"volumes","count":2},{"name":"cpu","count":1}]}`), &b); err != nil {
+		t.Fatal(err)
+	}
+	if a.hash() != b.hash() {
+		t.Errorf("wanted %s, but got %s: \n", a.hash(), b.hash())
+	}
+
+	b.Optionals[0].Count = oCount{3}
+	if a.hash() == b.hash() {
+		t.Errorf("wanted %s, but got %s: \n", "different hashes", "the same")
+	}
+}
+
+func TestProvenance(t *testing.T) {
+
+	os.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	defer os.Unsetenv("SOURCE_DATE_EPOCH")
+
+	i := expectedInput{ProjectName: "boogie-test", Environment: "dev"}
+	c := config{
+		flatOutput:          true,
+		usefileContentInput: true,
+		provenance:          true,
+		fileContent:         `[{"filename": "1-project.json", "content": {"kind": "Project", "apiVersion": "project.openshift.io/v1", "metadata": {"name": "{{ .ProjectName }}"}}}]`,
+	}
+	digest := sha256Hex([]byte(c.fileContent))
+
+	files, err := c.generate(&i)
+	if err != nil {
+		t.Fatalf("wanted \n%s, \nbut got \n%s \n", "no error", err.Error())
+	}
+	if len(files) != 2 || files[1].Filename != provenanceFile {
+		t.Fatalf("wanted %s, but got %v: \n", "the object and its provenance", files)
+	}
+
+	expectedRecord := `{"generatorVersion":"dev","templates":{"raw_stream":"` + digest + `"},"inputHash":"` + i.hash() + `","timestamp":"2023-11-14T22:13:20Z"}`
+	gotRecord, _ := json.Marshal(files[1].Content)
+	if string(gotRecord) != expectedRecord {
+		t.Errorf("wanted \n%s, \nbut got \n%s \n", expectedRecord, gotRecord)
+	}
+
+	annotations := files[0].annotations()
+	if annotations[templateAnnotation] != digest || annotations[inputAnnotation] != i.hash() || annotations[versionAnnotation] != "dev" {
+		t.Errorf("wanted %s, but got %v: \n", "provenance annotations", annotations)
+	}
+
+	// a List can only carry the objects
+	gotBytes, err := files.serialize(outputList, true)
+	if err != nil {
+		t.Fatalf("wanted \n%s, \nbut got \n%s \n", "no error", err.Error())
+	}
+	if strings.Contains(string(gotBytes), "generatorVersion") {
+		t.Errorf("wanted %s, but got %s: \n", "only objects", gotBytes)
+	}
+}
+
+func TestSignAndVerifyBundle(t *testing.T) {
+
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "signed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := GeneratedFiles{
+		{Filename: "10-quotas.json", SourceTemplate: "quotas.txt.tmpl", Content: map[string]interface{}{"kind": "ResourceQuota", "spec": map[string]interface{}{"hard": map[string]interface{}{"persistentvolumeclaims": float64(1)}}}},
+		{Filename: "1-project.json", SourceTemplate: "project.txt.tmpl", Content: map[string]interface{}{"kind": "Project"}},
+		{Filename: provenanceFile, SourceTemplate: "provenance", Content: provenanceRecord{GeneratorVersion: "dev"}},
+	}
+	signature, err := files.sign(private)
+	if err != nil {
+		t.Fatalf("wanted \n%s, \nbut got \n%s \n", "no error", err.Error())
+	}
+
+	// the same bundle verifies once written out as a directory, or as an envelope stream
+	signed := append(files, GeneratedFile{Filename: signatureFile, Content: rawContent(signature)})
+	if _, err := signed.writeDir(dir, existingFail, false); err != nil {
+		t.Fatal(err)
+	}
+	covered := map[string]bool{"1-project.json": true, "10-quotas.json": true, provenanceFile: true}
+	fromDir, extra, err := readBundleDir(dir, covered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fromDir.verify(public, signature); err != nil || len(extra) != 0 {
+		t.Errorf("wanted \n%s, \nbut got \n%v %v \n", "no error", err, extra)
+	}
+
+	stream, _ := files.envelope(false)
+	var fromStream GeneratedFiles
+	if err := json.Unmarshal(stream, &fromStream); err != nil {
+		t.Fatal(err)
+	}
+	if err := fromStream.verify(public, signature); err != nil {
+		t.Errorf("wanted \n%s, \nbut got \n%s \n", "no error", err.Error())
+	}
+
+	// any modification is detected
+	if err := ioutil.WriteFile(filepath.Join(dir, "1-project.json"), []byte(`{"kind":"Namespace"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tampered, _, _ := readBundleDir(dir, covered)
+	if err := tampered.verify(public, signature); err == nil {
+		t.Errorf("wanted %s, but got %s: \n", "an error", "nil")
+	}
+
+	// the signature names what it covers, so missing and extra files are reported rather than signed over
+	tests := []struct {
+		files GeneratedFiles
+		want  string
+	}{
+		{files[:2], "signed files are missing: provenance.json"},
+		{append(append(GeneratedFiles{}, files...), GeneratedFile{Filename: "20-stale.json", Content: map[string]interface{}{"kind": "Stale"}}),
+			"signature matches, but these files are not covered by it: 20-stale.json"},
+	}
+	for _, test := range tests {
+		if err := test.files.verify(public, signature); err == nil || err.Error() != test.want {
+			t.Errorf("wanted %s, but got %v: \n", test.want, err)
+		}
+	}
+
+	// neither a List nor a YAML stream carries filenames, so neither can be signed
+	for _, format := range []string{outputList, outputYAML} {
+		c := &config{signKey: "unused.pem", signatureOut: "unused.sig", outputFormat: format}
+		if _, err := c.signBundle(files); err == nil || !strings.Contains(err.Error(), "cannot be signed") {
+			t.Errorf("wanted %s, but got %v: \n", "cannot be signed", err)
+		}
+	}
+}
+
+func TestSignedInput(t *testing.T) {
+
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := map[string]ed25519.PublicKey{"portal-1": public}
+
+	payload := `{"projectname":"boogie-test","environment":"dev","optionals":[{"name":"cpu","count":1}]}`
+	// the canonical form has its keys sorted
+	canonical := `{"environment":"dev","optionals":[{"count":1,"name":"cpu"}],"projectname":"boogie-test"}`
+	value := base64.StdEncoding.EncodeToString(ed25519.Sign(private, []byte(canonical)))
+
+	signed := `{"projectname":"boogie-test","environment":"dev","optionals":[{"name":"cpu","count":1}],"signature":{"keyid":"portal-1","value":"` + value + `"}}`
+	if err := verifyInput([]byte(signed), keys); err != nil {
+		t.Errorf("wanted \n%s, \nbut got \n%s \n", "no error", err.Error())
+	}
+
+	// the signature is ignored by the decoder itself
+	d := expectedInput{}
+	if err := json.Unmarshal([]byte(signed), &d); err != nil || d.ProjectName != "boogie-test" {
+		t.Errorf("wanted %s, but got %v: \n", "boogie-test", err)
+	}
+
+	tests := []struct {
+		payload string
+		want    string
+	}{
+		{payload, "input is not signed"},
+		{strings.Replace(signed, `"count":1`, `"count":8`, 1), "input signature does not match its content"},
+		{strings.Replace(signed, "portal-1", "portal-2", 1), "input is signed by an untrusted key: portal-2"},
+		{`{"projectname":"boogie-test","signature":{"keyid":"portal-1"}}`, "input signature must carry a keyid and a value"},
+	}
+	for _, test := range tests {
+		err := verifyInput([]byte(test.payload), keys)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("wanted %s, but got %v: \n", test.want, err)
+		}
+	}
+
+	// every subcommand checks its payload against the keyring too, before going near a cluster
+	ring, err := ioutil.TempFile("", "keyring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(ring.Name())
+	ring.WriteString(`{"keys":[{"keyid":"portal-1","publickey":"` + base64.StdEncoding.EncodeToString(public) + `"}]}`)
+	ring.Close()
+
+	c := &config{inputKeyring: ring.Name()}
+	if data, err := c.loadInput(signed); err != nil || data.namespace() != "boogie-test" {
+		t.Errorf("wanted %s, but got %v: \n", "boogie-test", err)
+	}
+	want := "rejected input: input is not signed"
+	args := []string{"-generate", payload, "-input-keyring", ring.Name()}
+	if _, err := runDrift(&config{}, args); err == nil || err.Error() != want {
+		t.Errorf("wanted %s, but got %v: \n", want, err)
+	}
+	if _, err := runTeardown(&config{}, append(args, "-execute")); err == nil || err.Error() != want {
+		t.Errorf("wanted %s, but got %v: \n", want, err)
+	}
+	if err := runQuotaPatch(&config{}, args); err == nil || err.Error() != want {
+		t.Errorf("wanted %s, but got %v: \n", want, err)
+	}
+}
+
+func TestExplain(t *testing.T) {
+
+	c := &config{templateDir: "./templates/", fileList: []string{"project.txt.tmpl", "quotas.txt.tmpl", "rolebindings.txt.tmpl"}}
+	c.defaults, _ = loadDefaults("./templates/defaults.json")
+
+	data, given, err := partialInput(`{"environment":"dev","optionals":[{"name":"cpu","count":2}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := c.explain(data, given)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]explainedValue{}
+	for _, value := range values {
+		got[value.Name+" "+value.Template] = value
+	}
+	wanted := []explainedValue{
+		{Name: "cpu", Value: "2", Source: sourceInput, Template: "quotas.txt.tmpl"},
+		{Name: "memory", Value: "100Mi", Source: sourceProfile, Profile: "defaults", Template: "quotas.txt.tmpl"},
+		{Name: "volumes", Value: "1", Source: sourceProfile, Profile: "defaults", Template: "quotas.txt.tmpl"},
+		{Name: "storage", Value: "1Gi", Source: sourceProfile, Profile: "defaults", Template: "quotas.txt.tmpl"},
+		{Name: "projectname", Value: placeholderValue, Source: sourcePolicy, Template: "project.txt.tmpl"},
+		{Name: "environment", Value: "dev", Source: sourceInput, Template: "rolebindings.txt.tmpl"},
+	}
+	for _, want := range wanted {
+		if got[want.Name+" "+want.Template] != want {
+			t.Errorf("wanted %v, but got %v: \n", want, got[want.Name+" "+want.Template])
+		}
+	}
+	if _, ok := got["environment project.txt.tmpl"]; ok {
+		t.Errorf("wanted %s, but got %s: \n", "no environment for project.txt.tmpl", "one")
+	}
+	if c.recorder != nil {
+		t.Errorf("wanted %s, but got %s: \n", "recorder to be cleared", "recorder left in place")
+	}
+
+	// the partial input is still checked
+	if _, _, err := partialInput(`{"optionals":[{"name":"cpu","count":2,"unit":"X"}]}`); err == nil {
+		t.Errorf("wanted %s, but got %s: \n", "an error", "none")
+	}
+}
+
+func TestDefaultsFile(t *testing.T) {
+
+	dir := writeTemplates(t, map[string]string{
+		"defaults.json": `{
+			"defaults": {"cpu": "100m", "memory": "100Mi", "volumes": 1},
+			"environments": {
+				"PRD": {"values": {"memory": "1Gi"}, "clusters": {"prd-east": {"memory": "2Gi"}}}
+			}
+		}`,
+		"quotas.txt.tmpl": `{{ $data := . }}[{"filename": "10-quotas.json", "content": {"kind": "ResourceQuota", "apiVersion": "v1",
+			"metadata": {"name": "default-quotas", "namespace": "{{ $data.ProjectName }}"},
+			"spec": {"hard": {"limits.cpu": {{ getCPU $data }}, "limits.memory": {{ getMEM $data }}, "persistentvolumeclaims": {{ getPVC $data }}, "requests.storage": {{ getStorage $data "5Gi" }}}}}}]`,
+	})
+	defer os.RemoveAll(dir)
+
+	defaults, err := loadDefaults(dir + "defaults.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		environment string
+		cluster     string
+		input       []optionalObject
+		want        string
+	}{
+		{"dev", "", nil, `"limits.cpu":"100m","limits.memory":"100Mi","persistentvolumeclaims":1,"requests.storage":"5Gi"`},
+		{"prd", "", nil, `"limits.cpu":"100m","limits.memory":"1Gi","persistentvolumeclaims":1,"requests.storage":"5Gi"`},
+		{"prd", "prd-east", nil, `"limits.cpu":"100m","limits.memory":"2Gi","persistentvolumeclaims":1,"requests.storage":"5Gi"`},
+		{"prd", "prd-west", nil, `"limits.cpu":"100m","limits.memory":"1Gi","persistentvolumeclaims":1,"requests.storage":"5Gi"`},
+		// the input always wins
+		{"prd", "prd-east", []optionalObject{{Name: oName{"memory"}, Count: oCount{3}, Unit: oUnit{"Gi"}}}, `"limits.cpu":"100m","limits.memory":"3Gi","persistentvolumeclaims":1,"requests.storage":"5Gi"`},
+	}
+	for _, test := range tests {
+		c := &config{templateDir: dir, fileList: []string{"quotas.txt.tmpl"}, flatOutput: true, defaults: defaults, cluster: test.cluster}
+		gotBytes, err := c.process(&expectedInput{ProjectName: "boogie-test", Environment: test.environment, Optionals: test.input})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(gotBytes), test.want) {
+			t.Errorf("wanted \n%s, \nbut got \n%s \n", test.want, gotBytes)
+		}
+	}
+
+	// without a default anywhere, the template fails rather than producing broken JSON
+	c := &config{templateDir: dir, fileList: []string{"quotas.txt.tmpl"}}
+	_, err = c.process(&expectedInput{ProjectName: "boogie-test", Environment: "dev"})
+	if err == nil || !strings.Contains(err.Error(), "no default cpu for environment dev") {
+		t.Errorf("wanted %s, but got %v: \n", "no default cpu for environment dev", err)
+	}
+
+	// the shipped template still works when no defaults file is found, from the copy built in
+	quotas, err := ioutil.ReadFile("./templates/quotas.txt.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bare := writeTemplates(t, map[string]string{"quotas.txt.tmpl": string(quotas)})
+	defer os.RemoveAll(bare)
+	shipped, err := withDefaults(&config{templateDir: bare, fileList: []string{"quotas.txt.tmpl"}, flatOutput: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotBytes, err := shipped.process(&expectedInput{ProjectName: "boogie-test", Environment: "dev"})
+	want := `"limits.cpu":"100m","limits.memory":"100Mi","persistentvolumeclaims":1,"requests.storage":"1Gi"`
+	if err != nil || !strings.Contains(string(gotBytes), want) {
+		t.Errorf("wanted \n%s, \nbut got \n%s %v \n", want, gotBytes, err)
+	}
+	shippedDefaults, err := ioutil.ReadFile("./templates/defaults.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(shippedDefaults)) != strings.TrimSpace(builtinDefaults) {
+		t.Errorf("wanted \n%s, \nbut got \n%s \n", shippedDefaults, builtinDefaults)
+	}
+
+	for _, broken := range []string{
+		`{"defaults": {"gpu": 1}}`,
+		`{"defaults": {"cpu": 1.5}}`,
+		`{"defaults": {"cpu": true}}`,
+		`{"environment": {}}`,
+	} {
+		if err := ioutil.WriteFile(dir+"broken.json", []byte(broken), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadDefaults(dir + "broken.json"); err == nil {
+			t.Errorf("wanted %s, but got %s: \n", "an error for "+broken, "none")
+		}
+	}
+}
+
+func newFakeApplier() *applier {
+	// the fake dynamic client cannot apply, so apply is reduced to create or replace against a tracker of its own
+	scheme := runtime.NewScheme()
+	tracker := k8stesting.NewObjectTracker(scheme, serializer.NewCodecFactory(scheme).UniversalDecoder())
+	client := dynamicfake.NewSimpleDynamicClient(scheme)
+	client.PrependReactor("*", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch, ok := action.(k8stesting.PatchAction)
+		if !ok || patch.GetPatchType() != types.ApplyPatchType {
+			return k8stesting.ObjectReaction(tracker)(action)
+		}
+		applied := &unstructured.Unstructured{}
+		if err := applied.UnmarshalJSON(patch.GetPatch()); err != nil {
+			return true, nil, err
+		}
+		_, err := tracker.Get(patch.GetResource(), patch.GetNamespace(), patch.GetName())
+		if apierrors.IsNotFound(err) {
+			return true, applied, tracker.Create(patch.GetResource(), applied, patch.GetNamespace())
+		}
+		if err != nil {
+			return true, nil, err
+		}
+		return true, applied, tracker.Update(patch.GetResource(), applied, patch.GetNamespace())
+	})
+
+	served := map[schema.GroupVersionKind]meta.RESTScope{
+		{Group: "project.openshift.io", Version: "v1", Kind: "Project"}:             meta.RESTScopeRoot,
+		{Version: "v1", Kind: "ResourceQuota"}:                                      meta.RESTScopeNamespace,
+		{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "RoleBinding"}:    meta.RESTScopeNamespace,
+		{Group: "networking.k8s.io", Version: "v1", Kind: "NetworkPolicy"}:          meta.RESTScopeNamespace,
+		{Group: "network.openshift.io", Version: "v1", Kind: "EgressNetworkPolicy"}: meta.RESTScopeNamespace,
+		{Version: "v1", Kind: "PersistentVolumeClaim"}:                              meta.RESTScopeNamespace,
+		{Group: "apps", Version: "v1", Kind: "Deployment"}:                          meta.RESTScopeNamespace,
+		// served as it is by OpenShift 3.11, before batch/v1
+		{Group: "batch", Version: "v1beta1", Kind: "CronJob"}: meta.RESTScopeNamespace,
+	}
+	// like discovery, the mapper resolves a kind asked for without a version to the version served
+	var versions []schema.GroupVersion
+	for gvk := range served {
+		versions = append(versions, gvk.GroupVersion())
+	}
+	mapper := meta.NewDefaultRESTMapper(versions)
+	for gvk, scope := range served {
+		mapper.Add(gvk, scope)
+	}
+	return &applier{clusterClient: &clusterClient{client: client, mapper: mapper}, fieldManager: defaultFieldManager}
+}
+
+func TestApply(t *testing.T) {
+
+	c := &config{templateDir: "./templates/", fileList: []string{"project.txt.tmpl", "quotas.txt.tmpl"}}
+	c.defaults, _ = loadDefaults("./templates/defaults.json")
+	a := newFakeApplier()
+
+	applyWith := func(data *expectedInput) []string {
+		files, err := c.generate(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := a.apply(files)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, result := range results {
+			got = append(got, result.Kind+"/"+result.Name+" "+result.Result)
+		}
+		return got
+	}
+
+	data := &expectedInput{ProjectName: "boogie-test", Environment: "dev"}
+	tests := []struct {
+		data *expectedInput
+		want string
+	}{
+		{data, "Project/boogie-test created, ResourceQuota/default-quotas created"},
+		{data, "Project/boogie-test unchanged, ResourceQuota/default-quotas unchanged"},
+		{&expectedInput{ProjectName: "boogie-test", Environment: "dev", Optionals: []optionalObject{{Name: oName{"cpu"}, Count: oCount{2}}}},
+			"Project/boogie-test unchanged, ResourceQuota/default-quotas configured"},
+	}
+	for _, test := range tests {
+		got := strings.Join(applyWith(test.data), ", ")
+		if got != test.want {
+			t.Errorf("wanted %s, but got %s: \n", test.want, got)
+		}
+	}
+
+	// an object the cluster knows nothing about stops the apply, and is reported
+	files := GeneratedFiles{{Filename: "50-widget.json", SourceTemplate: "widgets.txt.tmpl", Content: map[string]interface{}{
+		"apiVersion": "example.com/v1", "kind": "Widget", "metadata": map[string]interface{}{"name": "w", "namespace": "boogie-test"},
+	}}}
+	results, err := a.apply(files)
+	if err == nil || !strings.Contains(err.Error(), "applying 50-widget.json from template widgets.txt.tmpl") {
+		t.Errorf("wanted %s, but got %v: \n", "applying 50-widget.json from template widgets.txt.tmpl", err)
+	}
+	if len(results) != 1 || results[0].Result != "failed" {
+		t.Errorf("wanted %s, but got %v: \n", "one failed result", results)
+	}
+}
+
+func TestPrune(t *testing.T) {
+
+	data := &expectedInput{ProjectName: "boogie-test", Environment: "dev"}
+	a := newFakeApplier()
+
+	c := &config{templateDir: "./templates/", fileList: []string{"project.txt.tmpl", "quotas.txt.tmpl", "rolebindings.txt.tmpl"}, templateSet: "core"}
+	c.defaults, _ = loadDefaults("./templates/defaults.json")
+	files, err := c.generate(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if labels := files[0].labels(); labels[managedByLabel] != managedByValue || labels[templateSetLabel] != "core" {
+		t.Errorf("wanted %s, but got %v: \n", "managed-by and template-set labels", labels)
+	}
+	if _, err := a.apply(files); err != nil {
+		t.Fatal(err)
+	}
+
+	// one binding is protected, and an object without the labels is nothing to do with us
+	protected := &unstructured.Unstructured{}
+	if err := protected.UnmarshalJSON([]byte(`{"apiVersion": "rbac.authorization.k8s.io/v1", "kind": "RoleBinding", "metadata": {"name": "kept-binding", "namespace": "boogie-test",
+		"labels": {"app.kubernetes.io/managed-by": "gobins-parser", "gobins.io/template-set": "core"}, "annotations": {"gobins.io/prune-protected": "true"}}}`)); err != nil {
+		t.Fatal(err)
+	}
+	unlabelled := &unstructured.Unstructured{}
+	if err := unlabelled.UnmarshalJSON([]byte(`{"apiVersion": "networking.k8s.io/v1", "kind": "NetworkPolicy", "metadata": {"name": "by-hand", "namespace": "boogie-test"}}`)); err != nil {
+		t.Fatal(err)
+	}
+	rolebindings := schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "rolebindings"}
+	networkpolicies := schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "networkpolicies"}
+	if _, err := a.client.Resource(rolebindings).Namespace("boogie-test").Create(protected, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.client.Resource(networkpolicies).Namespace("boogie-test").Create(unlabelled, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the rolebindings template is removed
+	c.fileList = []string{"project.txt.tmpl", "quotas.txt.tmpl"}
+	files, err = c.generate(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summary := func(results []pruneResult) string {
+		var got []string
+		for _, result := range results {
+			got = append(got, result.Kind+"/"+result.Name+" "+result.Result)
+		}
+		return strings.Join(got, ", ")
+	}
+
+	tests := []struct {
+		dryRun bool
+		want   string
+	}{
+		{true, "RoleBinding/adgroup-deploy-binding would prune, RoleBinding/adgroup-edit-binding would prune, RoleBinding/adgroup-manage-binding would prune, RoleBinding/adgroup-view-binding would prune, RoleBinding/kept-binding protected"},
+		{false, "RoleBinding/adgroup-deploy-binding pruned, RoleBinding/adgroup-edit-binding pruned, RoleBinding/adgroup-manage-binding pruned, RoleBinding/adgroup-view-binding pruned, RoleBinding/kept-binding protected"},
+		{false, "RoleBinding/kept-binding protected"},
+	}
+	for _, test := range tests {
+		results, err := a.prune(files, "boogie-test", "core", test.dryRun)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := summary(results); got != test.want {
+			t.Errorf("wanted %s, but got %s: \n", test.want, got)
+		}
+	}
+
+	if _, err := a.client.Resource(networkpolicies).Namespace("boogie-test").Get("by-hand", metav1.GetOptions{}); err != nil {
+		t.Errorf("wanted %s, but got %s: \n", "unlabelled object to be left alone", err.Error())
+	}
+
+	// an object generated under one version, but served under another, is still wanted
+	served := &unstructured.Unstructured{}
+	if err := served.UnmarshalJSON([]byte(`{"apiVersion": "rbac.authorization.k8s.io/v1", "kind": "RoleBinding", "metadata": {"name": "served-binding", "namespace": "boogie-test",
+		"labels": {"app.kubernetes.io/managed-by": "gobins-parser", "gobins.io/template-set": "core"}}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.client.Resource(rolebindings).Namespace("boogie-test").Create(served, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	files = append(files, GeneratedFile{Filename: "20-served.json", SourceTemplate: "served.txt.tmpl", Content: map[string]interface{}{
+		"apiVersion": "rbac.authorization.k8s.io/v1beta1", "kind": "RoleBinding", "metadata": map[string]interface{}{"name": "served-binding", "namespace": "boogie-test"},
+	}})
+	results, err := a.prune(files, "boogie-test", "core", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := summary(results); got != "RoleBinding/kept-binding protected" {
+		t.Errorf("wanted %s, but got %s: \n", "RoleBinding/kept-binding protected", got)
+	}
+}
+
+func TestDrift(t *testing.T) {
+
+	data := &expectedInput{ProjectName: "boogie-test", Environment: "dev"}
+	a := newFakeApplier()
+
+	c := &config{templateDir: "./templates/", fileList: []string{"project.txt.tmpl", "quotas.txt.tmpl"}, templateSet: "core"}
+	c.defaults, _ = loadDefaults("./templates/defaults.json")
+	files, err := c.generate(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.apply(files); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := a.drift(files, "boogie-test", "core")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Drifted {
+		t.Errorf("wanted %s, but got %v: \n", "no drift", report)
+	}
+
+	// memory is changed to the same quantity written differently, and cpu to a different one
+	quotas := schema.GroupVersionResource{Version: "v1", Resource: "resourcequotas"}
+	live, err := a.client.Resource(quotas).Namespace("boogie-test").Get("default-quotas", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unstructured.SetNestedField(live.Object, "102400Ki", "spec", "hard", "limits.memory")
+	unstructured.SetNestedField(live.Object, "2", "spec", "hard", "limits.cpu")
+	unstructured.SetNestedField(live.Object, int64(4), "status", "used", "pods")
+	if _, err := a.client.Resource(quotas).Namespace("boogie-test").Update(live, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	// the project is gone, and a binding from a removed template lingers
+	projects := schema.GroupVersionResource{Group: "project.openshift.io", Version: "v1", Resource: "projects"}
+	if err := a.client.Resource(projects).Delete("boogie-test", &metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	extra := &unstructured.Unstructured{}
+	extra.UnmarshalJSON([]byte(`{"apiVersion": "rbac.authorization.k8s.io/v1", "kind": "RoleBinding", "metadata": {"name": "old-binding", "namespace": "boogie-test",
+		"labels": {"app.kubernetes.io/managed-by": "gobins-parser", "gobins.io/template-set": "core"}}}`))
+	rolebindings := schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "rolebindings"}
+	if _, err := a.client.Resource(rolebindings).Namespace("boogie-test").Create(extra, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = a.drift(files, "boogie-test", "core")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(report)
+	want := `{"namespace":"boogie-test","drifted":true,` +
+		`"missing":[{"kind":"Project","name":"boogie-test","filename":"1-project.json"}],` +
+		`"extra":[{"kind":"RoleBinding","namespace":"boogie-test","name":"old-binding"}],` +
+		`"changed":[{"kind":"ResourceQuota","namespace":"boogie-test","name":"default-quotas","filename":"10-quotas.json","fields":[{"path":"spec.hard[\"limits.cpu\"]","expected":"100m","live":"2"}]}]}`
+	if string(b) != want {
+		t.Errorf("wanted \n%s, \nbut got \n%s \n", want, b)
+	}
+}
+
+func TestTeardown(t *testing.T) {
+
+	data := &expectedInput{ProjectName: "boogie-test", Environment: "dev"}
+	a := newFakeApplier()
+
+	c := &config{templateDir: "./templates/", fileList: []string{"project.txt.tmpl", "quotas.txt.tmpl", "networkpolicy.txt.tmpl"}}
+	c.defaults, _ = loadDefaults("./templates/defaults.json")
+	files, err := c.generate(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.apply(files); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, object := range []string{
+		`{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "web", "namespace": "boogie-test"}}`,
+		`{"apiVersion": "v1", "kind": "PersistentVolumeClaim", "metadata": {"name": "data", "namespace": "boogie-test"}}`,
+		`{"apiVersion": "batch/v1beta1", "kind": "CronJob", "metadata": {"name": "nightly", "namespace": "boogie-test"}}`,
+	} {
+		u := &unstructured.Unstructured{}
+		if err := u.UnmarshalJSON([]byte(object)); err != nil {
+			t.Fatal(err)
+		}
+		objects, err := a.resourceFor(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := objects.Create(u, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	steps := func(plan teardownPlan) string {
+		var got []string
+		for _, step := range plan.Delete {
+			got = append(got, strings.TrimSpace(step.Kind+"/"+step.Name+" "+step.Result))
+		}
+		return strings.Join(got, ", ")
+	}
+
+	// the plan is reported, but cannot be executed while the claim exists
+	plan, err := a.teardown(files, "boogie-test", false, true)
+	if err == nil || !strings.Contains(err.Error(), "data bearing resources still exist: PersistentVolumeClaim/data") {
+		t.Errorf("wanted %s, but got %v: \n", "data bearing resources still exist: PersistentVolumeClaim/data", err)
+	}
+	if !plan.Blocked || plan.Executed || len(plan.Present) != 3 {
+		t.Errorf("wanted %s, but got %v: \n", "a blocked plan listing the cronjob, deployment and claim", plan)
+	}
+	want := "EgressNetworkPolicy/default-egress, NetworkPolicy/default-deny-all, ResourceQuota/default-quotas, Project/boogie-test"
+	if got := steps(plan); got != want {
+		t.Errorf("wanted %s, but got %s: \n", want, got)
+	}
+
+	plan, err = a.teardown(files, "boogie-test", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "EgressNetworkPolicy/default-egress deleted, NetworkPolicy/default-deny-all deleted, ResourceQuota/default-quotas deleted, Project/boogie-test deleted"
+	if got := steps(plan); got != want || !plan.Executed {
+		t.Errorf("wanted %s, but got %s: \n", want, got)
+	}
+
+	// going again finds nothing left to delete
+	plan, err = a.teardown(files, "boogie-test", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Delete[0].Result != "already gone" {
+		t.Errorf("wanted %s, but got %s: \n", "already gone", plan.Delete[0].Result)
+	}
+}
+
+func TestQuotaPatch(t *testing.T) {
+
+	live := &coreTypes.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "default-quotas", Namespace: "boogie-test"},
+		Spec: coreTypes.ResourceQuotaSpec{Hard: coreTypes.ResourceList{
+			"limits.cpu":             resource.MustParse("1"),
+			"limits.memory":          resource.MustParse("1024Mi"),
+			"persistentvolumeclaims": resource.MustParse("1"),
+			"requests.storage":       resource.MustParse("1Gi"),
+		}},
+	}
+	client := kubefake.NewSimpleClientset(live).CoreV1()
+
+	c := &config{templateDir: "./templates/", fileList: []string{"project.txt.tmpl", "quotas.txt.tmpl"}}
+	c.defaults, _ = loadDefaults("./templates/defaults.json")
+	input := func(optionals string) *expectedInput {
+		data := &expectedInput{}
+		if err := json.Unmarshal([]byte(`{"projectname":"boogie-test","environment":"dev","optionals":[`+optionals+`]}`), data); err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	same := `{"name":"cpu","count":1},{"name":"memory","count":1,"unit":"Gi"},{"name":"volumes","count":1},{"name":"storage","count":1,"unit":"Gi"}`
+
+	// the same limits, however they are written, produce nothing
+	result, err := c.quotaPatch(client, input(same), defaultMaxIncrease, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Patch != nil || len(result.Changes) != 0 {
+		t.Errorf("wanted %s, but got %s: \n", "no patch", result.Patch)
+	}
+
+	// only the changed keys are patched
+	result, err = c.quotaPatch(client, input(strings.Replace(same, `"count":1,"unit":"Gi"}`, `"count":2,"unit":"Gi"}`, 1)), defaultMaxIncrease, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"spec":{"hard":{"limits.memory":"2Gi"}}}`
+	if string(result.Patch) != want {
+		t.Errorf("wanted %s, but got %s: \n", want, result.Patch)
+	}
+	var table strings.Builder
+	if err := writeQuotaTable(&table, result.Name, result.Changes); err != nil {
+		t.Fatal(err)
+	}
+	want = "RESOURCEQUOTA   RESOURCE       BEFORE  AFTER  CHANGE\ndefault-quotas  limits.memory  1Gi     2Gi    x2.00\n"
+	if table.String() != want {
+		t.Errorf("wanted \n%s, \nbut got \n%s \n", want, table.String())
+	}
+
+	// growing more than allowed is refused, unless forced
+	big := strings.Replace(same, `{"name":"cpu","count":1}`, `{"name":"cpu","count":8}`, 1)
+	_, err = c.quotaPatch(client, input(big), defaultMaxIncrease, false)
+	if err == nil || !strings.Contains(err.Error(), "limits.cpu from 1 to 8 is 8.0 times the current limit") {
+		t.Errorf("wanted %s, but got %v: \n", "limits.cpu from 1 to 8 is 8.0 times the current limit", err)
+	}
+	result, err = c.quotaPatch(client, input(big), defaultMaxIncrease, true)
+	if err != nil || string(result.Patch) != `{"spec":{"hard":{"limits.cpu":"8"}}}` {
+		t.Errorf("wanted %s, but got %s, %v: \n", `{"spec":{"hard":{"limits.cpu":"8"}}}`, result.Patch, err)
+	}
+
+	// a new limit, or one growing from zero, has no multiple to check, so is refused too
+	zero := resource.MustParse("0")
+	huge := resource.MustParse("16Pi")
+	tests := []struct {
+		change quotaChange
+		want   string
+	}{
+		{quotaChange{Resource: "requests.cpu", After: resource.MustParse("1")}, "requests.cpu of 1 is a new limit"},
+		{quotaChange{Resource: "limits.cpu", Before: &zero, After: resource.MustParse("1")}, "limits.cpu from 0 to 1 is an increase from nothing"},
+		// large enough for MilliValue to overflow
+		{quotaChange{Resource: "requests.storage", Before: &huge, After: resource.MustParse("24Pi")}, ""},
+		{quotaChange{Resource: "requests.storage", Before: &huge, After: resource.MustParse("48Pi")}, "requests.storage from 16Pi to 48Pi is 3.0 times the current limit"},
+	}
+	for _, test := range tests {
+		err := checkIncreases([]quotaChange{test.change}, defaultMaxIncrease)
+		if test.want == "" && err != nil || test.want != "" && (err == nil || !strings.Contains(err.Error(), test.want)) {
+			t.Errorf("wanted %s, but got %v: \n", test.want, err)
+		}
+	}
+}
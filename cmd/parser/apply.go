@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/nicgrobler/gobins/internal/kubeconfig"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+	"k8s.io/client-go/restmapper"
+)
+
+/*
+	Applies the generated objects straight to a cluster with server-side apply, rather than leaving that to oc, so
+	that the parser's own field manager owns the fields it sets, and a failure is reported against the file that
+	caused it. Objects are applied in apply order, and the first failure stops the rest.
+*/
+
+const defaultFieldManager = "gobins-parser"
+
+// what applying an object did to it
+const (
+	applyCreated    = "created"
+	applyConfigured = "configured"
+	applyUnchanged  = "unchanged"
+)
+
+type clusterTarget struct {
+	kubeconfig string
+	context    string
+	local      bool // use the pod's service account, rather than a kubeconfig
+}
+
+// clusterClient reaches any kind of object the cluster serves
+type clusterClient struct {
+	client dynamic.Interface
+	mapper meta.RESTMapper
+}
+
+type applier struct {
+	*clusterClient
+	fieldManager string
+	force        bool // take ownership of fields managed by someone else, rather than failing on the conflict
+}
+
+type applyResult struct {
+	Filename  string `json:"filename"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Result    string `json:"result"`
+}
+
+func newClusterClient(target clusterTarget) (*clusterClient, error) {
+	config, err := kubeconfig.Get(target.kubeconfig, target.context, target.local)
+	if err != nil {
+		return nil, err
+	}
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("generate dynamic client from config failed: %s", err.Error())
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("generate discovery client from config failed: %s", err.Error())
+	}
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient))
+	return &clusterClient{client: client, mapper: mapper}, nil
+}
+
+func newApplier(target clusterTarget, fieldManager string, force bool) (*applier, error) {
+	c, err := newClusterClient(target)
+	if err != nil {
+		return nil, err
+	}
+	return &applier{clusterClient: c, fieldManager: fieldManager, force: force}, nil
+}
+
+func toUnstructured(file GeneratedFile) (*unstructured.Unstructured, error) {
+	content, err := normalizeContent(file.Content)
+	if err != nil {
+		return nil, err
+	}
+	object, ok := content.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: content is not an object", file.Filename)
+	}
+	// json.Number is not something unstructured objects can hold
+	b, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+	u := &unstructured.Unstructured{}
+	if err := u.UnmarshalJSON(b); err != nil {
+		return nil, fmt.Errorf("%s: %s", file.Filename, err.Error())
+	}
+	return u, nil
+}
+
+func (c *clusterClient) resourceFor(u *unstructured.Unstructured) (dynamic.ResourceInterface, error) {
+	gvk := u.GroupVersionKind()
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, err
+	}
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		return c.client.Resource(mapping.Resource).Namespace(u.GetNamespace()), nil
+	}
+	return c.client.Resource(mapping.Resource), nil
+}
+
+func withoutVolatileFields(u *unstructured.Unstructured) map[string]interface{} {
+	// drops what the server changes on every write, even one that changes nothing else
+	c := u.DeepCopy()
+	c.SetResourceVersion("")
+	c.SetManagedFields(nil)
+	return c.Object
+}
+
+func (a *applier) applyObject(file GeneratedFile) (applyResult, error) {
+	u, err := toUnstructured(file)
+	if err != nil {
+		return applyResult{Filename: file.Filename}, err
+	}
+	result := applyResult{Filename: file.Filename, Kind: u.GetKind(), Namespace: u.GetNamespace(), Name: u.GetName()}
+
+	resource, err := a.resourceFor(u)
+	if err != nil {
+		return result, err
+	}
+	existing, err := resource.Get(u.GetName(), metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return result, err
+	}
+	if err != nil {
+		existing = nil
+	}
+
+	body, err := u.MarshalJSON()
+	if err != nil {
+		return result, err
+	}
+	force := a.force
+	applied, err := resource.Patch(u.GetName(), types.ApplyPatchType, body, metav1.PatchOptions{FieldManager: a.fieldManager, Force: &force})
+	if err != nil {
+		return result, err
+	}
+
+	switch {
+	case existing == nil:
+		result.Result = applyCreated
+	case equality.Semantic.DeepEqual(withoutVolatileFields(existing), withoutVolatileFields(applied)):
+		result.Result = applyUnchanged
+	default:
+		result.Result = applyConfigured
+	}
+	return result, nil
+}
+
+func (a *applier) apply(files GeneratedFiles) ([]applyResult, error) {
+	// returns what was done to each object, up to and including the one that failed
+	var results []applyResult
+	for _, file := range files.objects().inApplyOrder() {
+		result, err := a.applyObject(file)
+		if err != nil {
+			result.Result = "failed"
+			results = append(results, result)
+			return results, fmt.Errorf("applying %s from template %s: %s", file.Filename, file.SourceTemplate, err.Error())
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"sigs.k8s.io/yaml"
+)
+
+// output formats which can be written to STDOUT
+const (
+	outputEnvelope = "envelope"
+	outputList     = "list"
+	outputYAML     = "yaml"
+)
+
+// only usable together with an output directory
+const outputKustomize = "kustomize"
+
+// labels identifying objects, and bundles, that the parser is responsible for
+const (
+	managedByLabel   = "app.kubernetes.io/managed-by"
+	managedByValue   = "gobins-parser"
+	projectLabel     = "gobins.io/project"
+	environmentLabel = "gobins.io/environment"
+	templateSetLabel = "gobins.io/template-set"
+)
+
+// GeneratedFile is a single object produced by a template, along with the name of the file it belongs in.
+type GeneratedFile struct {
+	Content        interface{} `json:"content"`
+	Filename       string      `json:"filename"`
+	SourceTemplate string      `json:"-"`
+}
+
+// GeneratedFiles is everything produced for one input, in template order. Every output format is serialized from it.
+type GeneratedFiles []GeneratedFile
+
+// objectList is a Kubernetes v1 List, accepted as a single document by "oc apply -f -"
+type objectList struct {
+	APIVersion string                 `json:"apiVersion"`
+	Kind       string                 `json:"kind"`
+	Metadata   map[string]interface{} `json:"metadata"`
+	Items      []interface{}          `json:"items"`
+}
+
+func (file GeneratedFile) field(name string) string {
+	content, _ := file.Content.(map[string]interface{})
+	return stringOrEmpty(content[name])
+}
+
+func (file GeneratedFile) kind() string {
+	return file.field("kind")
+}
+
+func (file GeneratedFile) name() string {
+	return stringOrEmpty(file.metadata()["name"])
+}
+
+func (file GeneratedFile) namespace() string {
+	return stringOrEmpty(file.metadata()["namespace"])
+}
+
+func (file GeneratedFile) metadata() map[string]interface{} {
+	content, _ := file.Content.(map[string]interface{})
+	metadata, _ := content["metadata"].(map[string]interface{})
+	return metadata
+}
+
+func (file GeneratedFile) metadataMap(name string) map[string]interface{} {
+	// returns the named map within the object's metadata, creating it if the template did not set one
+	content, _ := file.Content.(map[string]interface{})
+	metadata, _ := content["metadata"].(map[string]interface{})
+	values, ok := metadata[name].(map[string]interface{})
+	if !ok {
+		values = make(map[string]interface{})
+		metadata[name] = values
+	}
+	return values
+}
+
+func (file GeneratedFile) annotations() map[string]interface{} {
+	return file.metadataMap("annotations")
+}
+
+func (file GeneratedFile) labels() map[string]interface{} {
+	return file.metadataMap("labels")
+}
+
+func (file GeneratedFile) isObject() bool {
+	// everything is an object, apart from the records describing the bundle itself
+	switch file.Content.(type) {
+	case provenanceRecord, rawContent:
+		return false
+	}
+	return true
+}
+
+func (files GeneratedFiles) objects() GeneratedFiles {
+	var objects GeneratedFiles
+	for _, file := range files {
+		if file.isObject() {
+			objects = append(objects, file)
+		}
+	}
+	return objects
+}
+
+func applyRank(kind string) int {
+	// projects and namespaces must exist before anything can be created inside them
+	switch {
+	case kind == "Project" || kind == "Namespace":
+		return 0
+	case !isNamespaced(kind):
+		return 1
+	}
+	return 2
+}
+
+func (files GeneratedFiles) inApplyOrder() GeneratedFiles {
+	// returns a copy ordered for creation, keeping template order within each rank
+	ordered := make(GeneratedFiles, len(files))
+	copy(ordered, files)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return applyRank(ordered[i].kind()) < applyRank(ordered[j].kind())
+	})
+	return ordered
+}
+
+func (files GeneratedFiles) serialize(format string, flat bool) ([]byte, error) {
+	switch format {
+	case outputEnvelope, "":
+		return files.envelope(flat)
+	case outputList:
+		return files.list(flat)
+	case outputYAML:
+		return files.yaml()
+	case outputKustomize:
+		return nil, errors.New("the kustomize format can only be written to a directory, use -out")
+	}
+	return nil, fmt.Errorf("unknown output format: %s", format)
+}
+
+func marshal(v interface{}, flat bool) ([]byte, error) {
+	if flat {
+		return json.Marshal(v)
+	}
+	return json.MarshalIndent(v, "", "  ")
+}
+
+func (files GeneratedFiles) envelope(flat bool) ([]byte, error) {
+	// the original output format: [{"content": {...}, "filename": "..."}]
+	if files == nil {
+		files = GeneratedFiles{}
+	}
+	return marshal(files, flat)
+}
+
+func (files GeneratedFiles) list(flat bool) ([]byte, error) {
+	list := objectList{
+		APIVersion: "v1",
+		Kind:       "List",
+		Metadata:   map[string]interface{}{},
+		Items:      []interface{}{},
+	}
+	// a List may only hold objects, the provenance is still stamped on each of them
+	for _, file := range files.objects().inApplyOrder() {
+		list.Items = append(list.Items, file.Content)
+	}
+	return marshal(list, flat)
+}
+
+func (files GeneratedFiles) yaml() ([]byte, error) {
+	/*
+		a multi-document stream, one object per document. Keys are sorted by the encoder, so the same input always
+		renders identically, and each document is headed by a comment naming where it came from.
+	*/
+	var b bytes.Buffer
+	for _, file := range files {
+		if !file.isObject() {
+			record, err := json.Marshal(file.Content)
+			if err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(&b, "# %s: %s\n", file.Filename, record)
+		}
+	}
+	for _, file := range files.objects().inApplyOrder() {
+		doc, err := yaml.Marshal(file.Content)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %s: %s", file.SourceTemplate, file.Filename, err.Error())
+		}
+		b.WriteString("---\n")
+		fmt.Fprintf(&b, "# filename: %s\n", file.Filename)
+		fmt.Fprintf(&b, "# source: %s\n", file.SourceTemplate)
+		b.Write(doc)
+	}
+	return b.Bytes(), nil
+}
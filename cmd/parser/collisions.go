@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+/*
+	Templates are rendered independently of one another, so nothing stops two of them from claiming the same output
+	file, or from producing the same object. Either would silently leave two competing definitions in the output,
+	so every entry is recorded against the template which produced it, and any overlap is reported in full.
+*/
+
+type collisionTracker struct {
+	filenames  map[string]string // filename -> template
+	identities map[string]string // object identity -> template
+	report     []string
+}
+
+func newCollisionTracker() *collisionTracker {
+	return &collisionTracker{
+		filenames:  make(map[string]string),
+		identities: make(map[string]string),
+	}
+}
+
+func objectIdentity(content interface{}) string {
+	// apiVersion/kind namespace/name, the namespace being empty for cluster scoped objects
+	fields, _ := content.(map[string]interface{})
+	metadata, _ := fields["metadata"].(map[string]interface{})
+	return fmt.Sprintf("%v/%v %v/%v", fields["apiVersion"], fields["kind"], stringOrEmpty(metadata["namespace"]), metadata["name"])
+}
+
+func stringOrEmpty(value interface{}) string {
+	s, _ := value.(string)
+	return s
+}
+
+func (t *collisionTracker) add(files []GeneratedFile) {
+	for _, file := range files {
+		if first, seen := t.filenames[file.Filename]; seen {
+			t.report = append(t.report, fmt.Sprintf("filename %s is produced by templates %s and %s", file.Filename, first, file.SourceTemplate))
+		} else {
+			t.filenames[file.Filename] = file.SourceTemplate
+		}
+
+		identity := objectIdentity(file.Content)
+		if first, seen := t.identities[identity]; seen {
+			t.report = append(t.report, fmt.Sprintf("object %s is produced by templates %s and %s", identity, first, file.SourceTemplate))
+		} else {
+			t.identities[identity] = file.SourceTemplate
+		}
+	}
+}
+
+func (t *collisionTracker) err() error {
+	if len(t.report) == 0 {
+		return nil
+	}
+	return errors.New("templates produce colliding output:\n  " + strings.Join(t.report, "\n  "))
+}
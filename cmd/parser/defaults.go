@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/template"
+)
+
+/*
+	The values used for optionals the input leaves out come from a defaults file, rather than from the templates, so
+	that they can be changed without touching template logic, and can differ per environment and per cluster:
+
+		{
+		  "defaults": {"cpu": "100m", "memory": "100Mi", "volumes": 1, "storage": "1Gi"},
+		  "environments": {
+		    "prd": {
+		      "values": {"memory": "1Gi"},
+		      "clusters": {"prd-east": {"memory": "2Gi"}}
+		    }
+		  }
+		}
+
+	The most specific entry wins: the environment's cluster, then the environment, then the file wide defaults. A
+	default given in the template itself, as in getCPU $data "100m", is only used when the file has none.
+
+	When no defaults file is found at all, the copy of templates/defaults.json built into the binary is used, so the
+	shipped templates work without one.
+*/
+
+const defaultsFileName = "defaults.json"
+
+// builtinDefaults must match templates/defaults.json, which a test checks
+const builtinDefaults = `{
+  "defaults": {
+    "cpu": "100m",
+    "memory": "100Mi",
+    "volumes": 1,
+    "storage": "1Gi"
+  },
+  "environments": {}
+}
+`
+
+type defaultValues map[string]interface{}
+
+type environmentDefaults struct {
+	Values   defaultValues            `json:"values"`
+	Clusters map[string]defaultValues `json:"clusters"`
+}
+
+type defaultsFile struct {
+	Defaults     defaultValues                  `json:"defaults"`
+	Environments map[string]environmentDefaults `json:"environments"`
+}
+
+func loadDefaults(filename string) (*defaultsFile, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return parseDefaults(filename, b)
+}
+
+func parseDefaults(filename string, b []byte) (*defaultsFile, error) {
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+	decoder.UseNumber()
+	d := &defaultsFile{}
+	if err := decoder.Decode(d); err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err.Error())
+	}
+
+	// environments are matched against the lower cased input
+	environments := make(map[string]environmentDefaults, len(d.Environments))
+	for env, e := range d.Environments {
+		environments[strings.ToLower(env)] = e
+	}
+	d.Environments = environments
+
+	if err := d.Defaults.check(); err != nil {
+		return nil, fmt.Errorf("%s: defaults: %s", filename, err.Error())
+	}
+	for env, e := range d.Environments {
+		if err := e.Values.check(); err != nil {
+			return nil, fmt.Errorf("%s: environment %s: %s", filename, env, err.Error())
+		}
+		for cluster, values := range e.Clusters {
+			if err := values.check(); err != nil {
+				return nil, fmt.Errorf("%s: environment %s, cluster %s: %s", filename, env, cluster, err.Error())
+			}
+		}
+	}
+	return d, nil
+}
+
+func (values defaultValues) check() error {
+	// names must be known optionals, and values either strings or whole numbers, as a template default would be
+	for name, value := range values {
+		if !validName(name) {
+			return errors.New("unknown optional: " + name)
+		}
+		switch v := value.(type) {
+		case string:
+		case json.Number:
+			i, err := v.Int64()
+			if err != nil {
+				return fmt.Errorf("%s must be a string or a whole number: %s", name, v)
+			}
+			values[name] = int(i)
+		default:
+			return fmt.Errorf("%s must be a string or a whole number", name)
+		}
+	}
+	return nil
+}
+
+func (d *defaultsFile) lookup(environment, cluster, name string) (interface{}, string, bool) {
+	// returns the default for name, along with the profile it was found in
+	if d == nil {
+		return nil, "", false
+	}
+	if e, ok := d.Environments[environment]; ok {
+		if cluster != "" {
+			if value, ok := e.Clusters[cluster][name]; ok {
+				return value, environment + "/" + cluster, true
+			}
+		}
+		if value, ok := e.Values[name]; ok {
+			return value, environment, true
+		}
+	}
+	if value, ok := d.Defaults[name]; ok {
+		return value, "defaults", true
+	}
+	return nil, "", false
+}
+
+func defaultsFilename(templateDir string) string {
+	// DEFAULTS_FILE wins, otherwise a defaults.json sitting next to the templates, the working directory when
+	// TEMPLATEDIR is unset, is used when present
+	if filename := removeSpaces(os.Getenv("DEFAULTS_FILE")); filename != "" {
+		return filename
+	}
+	if _, err := os.Stat(templateDir + defaultsFileName); err != nil {
+		return ""
+	}
+	return templateDir + defaultsFileName
+}
+
+type optionalFunc func(data *expectedInput, templateDefault ...interface{}) (string, error)
+
+func (c *config) optional(templateName, name string, getter optionalGetter) optionalFunc {
+	return func(data *expectedInput, templateDefault ...interface{}) (string, error) {
+		var defaultValue interface{}
+		source, profile := sourceInput, ""
+		if data.getOptional(name) == nil {
+			if value, from, ok := c.defaults.lookup(data.Environment, c.cluster, name); ok {
+				defaultValue, source, profile = value, sourceProfile, from
+			} else if len(templateDefault) > 0 {
+				defaultValue, source = templateDefault[0], sourceTemplateDefault
+			} else {
+				return "", fmt.Errorf("no default %s for environment %s", name, data.Environment)
+			}
+		}
+		value := getter(data, defaultValue)
+		if c.recorder != nil {
+			c.recorder.record(explainedValue{Name: name, Value: strings.Trim(value, "\""), Source: source, Profile: profile, Template: templateName})
+		}
+		return value, nil
+	}
+}
+
+func (c *config) funcMap(templateName string) template.FuncMap {
+	funcs := getFuncMap()
+	funcs["getCPU"] = c.optional(templateName, "cpu", getCPU)
+	funcs["getMEM"] = c.optional(templateName, "memory", getMEM)
+	funcs["getPVC"] = c.optional(templateName, "volumes", getPVC)
+	funcs["getStorage"] = c.optional(templateName, "storage", getStorage)
+	return funcs
+}
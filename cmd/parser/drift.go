@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*
+	drift renders the bundle for an input, and compares it with what is live in the cluster:
+
+		parser drift -generate '{...}' -kubeconfig ~/.kube/config -context prd
+
+	Objects the bundle has, but the cluster does not, are missing. Objects labelled as managed by the parser, in the
+	project's namespace, which the bundle no longer has, are extra. Everything else is compared field by field, only
+	looking at the fields the bundle sets, since the cluster adds plenty of its own. Quantities are compared by value,
+	so "1Gi" and "1024Mi" are the same.
+
+	The report is written to STDOUT, and the exit code is 2 when anything has drifted.
+*/
+
+const driftExitCode = 2
+
+type objectRef struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Filename  string `json:"filename,omitempty"`
+}
+
+type fieldDiff struct {
+	Path     string      `json:"path"`
+	Expected interface{} `json:"expected"`
+	Live     interface{} `json:"live"`
+}
+
+type changedObject struct {
+	objectRef
+	Fields []fieldDiff `json:"fields"`
+}
+
+type driftReport struct {
+	Namespace string          `json:"namespace"`
+	Drifted   bool            `json:"drifted"`
+	Missing   []objectRef     `json:"missing"`
+	Extra     []objectRef     `json:"extra"`
+	Changed   []changedObject `json:"changed"`
+}
+
+func pathOf(parent, key string) string {
+	if strings.ContainsAny(key, ".[]\"") {
+		return parent + "[" + strconv.Quote(key) + "]"
+	}
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
+
+func sameQuantity(expected, live interface{}) bool {
+	// only when both sides read as quantities, anything else having to be equal as it is
+	parse := func(v interface{}) (resource.Quantity, bool) {
+		switch v.(type) {
+		case string, int64, float64:
+			q, err := resource.ParseQuantity(fmt.Sprint(v))
+			return q, err == nil
+		}
+		return resource.Quantity{}, false
+	}
+	e, ok := parse(expected)
+	if !ok {
+		return false
+	}
+	l, ok := parse(live)
+	if !ok {
+		return false
+	}
+	return e.Cmp(l) == 0
+}
+
+func diffFields(path string, expected, live interface{}) []fieldDiff {
+	// everything in expected must be in live, anything live has beyond that is ignored
+	switch e := expected.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			return []fieldDiff{{Path: path, Expected: expected, Live: live}}
+		}
+		keys := make([]string, 0, len(e))
+		for key := range e {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		var diffs []fieldDiff
+		for _, key := range keys {
+			diffs = append(diffs, diffFields(pathOf(path, key), e[key], l[key])...)
+		}
+		return diffs
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok || len(l) != len(e) {
+			return []fieldDiff{{Path: path, Expected: expected, Live: live}}
+		}
+		var diffs []fieldDiff
+		for i := range e {
+			diffs = append(diffs, diffFields(fmt.Sprintf("%s[%d]", path, i), e[i], l[i])...)
+		}
+		return diffs
+	}
+	if reflect.DeepEqual(expected, live) || sameQuantity(expected, live) {
+		return nil
+	}
+	return []fieldDiff{{Path: path, Expected: expected, Live: live}}
+}
+
+func (c *clusterClient) drift(files GeneratedFiles, namespace, templateSet string) (driftReport, error) {
+	report := driftReport{Namespace: namespace, Missing: []objectRef{}, Extra: []objectRef{}, Changed: []changedObject{}}
+
+	for _, file := range files.objects().inApplyOrder() {
+		expected, err := toUnstructured(file)
+		if err != nil {
+			return report, err
+		}
+		ref := objectRef{Kind: expected.GetKind(), Namespace: expected.GetNamespace(), Name: expected.GetName(), Filename: file.Filename}
+		objects, err := c.resourceFor(expected)
+		if err != nil {
+			return report, fmt.Errorf("%s: %s", file.Filename, err.Error())
+		}
+		live, err := objects.Get(expected.GetName(), metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			report.Missing = append(report.Missing, ref)
+			continue
+		}
+		if err != nil {
+			return report, fmt.Errorf("%s: %s", file.Filename, err.Error())
+		}
+		if diffs := diffFields("", expected.Object, live.Object); len(diffs) > 0 {
+			report.Changed = append(report.Changed, changedObject{objectRef: ref, Fields: diffs})
+		}
+	}
+
+	live, err := c.listLabelled(files.pruneKinds(), namespace, templateSetSelector(templateSet))
+	if err != nil {
+		return report, err
+	}
+	wanted := files.identities(namespace)
+	for _, item := range live {
+		if !wanted[item.identity()] {
+			report.Extra = append(report.Extra, objectRef{Kind: item.kind, Namespace: namespace, Name: item.GetName()})
+		}
+	}
+
+	report.Drifted = len(report.Missing) > 0 || len(report.Extra) > 0 || len(report.Changed) > 0
+	return report, nil
+}
+
+func runDrift(c *config, args []string) (driftReport, error) {
+	cmd := newClusterCommand(c, "drift", "the json payload the expected objects are generated from")
+	cmd.flags.StringVar(&c.templateSet, "template-set", "", "the template set the objects were applied with, which extra objects are looked for in")
+	data, err := cmd.parse(c, args)
+	if err != nil {
+		return driftReport{}, err
+	}
+	files, err := c.generate(data)
+	if err != nil {
+		return driftReport{}, err
+	}
+	client, err := newClusterClient(c.kube)
+	if err != nil {
+		return driftReport{}, err
+	}
+	return client.drift(files, data.namespace(), c.templateSet)
+}
@@ -3,10 +3,14 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"strings"
 	"text/template"
 )
 
+// number of rendered lines shown before the offending line when reporting a JSON error
+const snippetContextLines = 2
+
 func replace(input, from, to string) string {
 	return strings.Replace(input, from, to, -1)
 }
@@ -19,34 +23,95 @@ func lower(input string) string {
 	return strings.ToLower(input)
 }
 
-func getInterfaceFromTemplate(tpl *template.Template, data interface{}) (result interface{}) {
+// renderError is returned when a template executes cleanly, but the text it produces is not valid JSON.
+type renderError struct {
+	template string
+	line     int
+	column   int
+	snippet  string
+	err      error
+}
+
+func (e *renderError) Error() string {
+	return fmt.Sprintf("template %s produced invalid json at line %d, column %d: %s\n%s", e.template, e.line, e.column, e.err.Error(), e.snippet)
+}
+
+func newRenderError(name string, rendered []byte, offset int64, err error) *renderError {
+	/*
+		the offset reported by encoding/json is the number of bytes consumed when the error was detected,
+		so the offending byte is the one before it.
+	*/
+	pos := int(offset) - 1
+	if pos < 0 {
+		pos = 0
+	}
+	if pos > len(rendered) {
+		pos = len(rendered)
+	}
+	line := bytes.Count(rendered[:pos], []byte("\n")) + 1
+	lineStart := bytes.LastIndexByte(rendered[:pos], '\n') + 1
+	column := pos - lineStart + 1
+
+	return &renderError{
+		template: name,
+		line:     line,
+		column:   column,
+		snippet:  snippetAround(rendered, line, column),
+		err:      err,
+	}
+}
+
+func snippetAround(rendered []byte, line, column int) string {
+	// returns the offending line and a few before it, followed by a marker pointing at the column
+	lines := strings.Split(string(rendered), "\n")
+	first := line - 1 - snippetContextLines
+	if first < 0 {
+		first = 0
+	}
+	var b strings.Builder
+	for i := first; i < line && i < len(lines); i++ {
+		fmt.Fprintf(&b, "%5d | %s\n", i+1, lines[i])
+	}
+	fmt.Fprintf(&b, "      | %s^", strings.Repeat(" ", column-1))
+	return b.String()
+}
 
+func renderTemplate(tpl *template.Template, data interface{}) ([]byte, error) {
 	b := bytes.Buffer{}
 	if err := tpl.Execute(&b, data); err != nil {
-		exitLog("program exited due to error in executing template: " + err.Error())
+		return nil, fmt.Errorf("error in executing template %s: %s", tpl.Name(), err.Error())
 	}
+	return b.Bytes(), nil
+}
 
-	err := json.Unmarshal(b.Bytes(), &result)
-	if err != nil {
-		exitLog("program exited due to error in json unmarshalling: " + err.Error())
+func decodeRendered(name string, rendered []byte, v interface{}) error {
+	// unmarshals the output of a template, pointing at the offending text if it is not valid JSON
+	err := json.Unmarshal(rendered, v)
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case *json.SyntaxError:
+		return newRenderError(name, rendered, e.Offset, err)
+	case *json.UnmarshalTypeError:
+		return newRenderError(name, rendered, e.Offset, err)
 	}
-	return
+	return fmt.Errorf("error in json unmarshalling output of template %s: %s", name, err.Error())
 }
 
-func getTemplateFromFile(fileName, filePath string, funcMap template.FuncMap) *template.Template {
+func getTemplateFromFile(fileName, filePath string, funcMap template.FuncMap) (*template.Template, error) {
 	tpl := template.New(fileName).Funcs(funcMap)
 	t, err := tpl.ParseFiles(filePath)
 	if err != nil {
-		exitLog("program exited due to error in reading template from file " + filePath + ": " + err.Error())
+		return nil, fmt.Errorf("error in reading template from file %s: %s", filePath, err.Error())
 	}
-	return t
+	return t, nil
 }
 
-func getTemplateFromString(name, b string, funcMap template.FuncMap) *template.Template {
+func getTemplateFromString(name, b string, funcMap template.FuncMap) (*template.Template, error) {
 	tpl := template.New(name).Funcs(funcMap)
 	t, err := tpl.Parse(b)
 	if err != nil {
-		exitLog("program exited due to error in reading template from string " + b + ": " + err.Error())
+		return nil, fmt.Errorf("error in reading template %s from string: %s", name, err.Error())
 	}
-	return t
+	return t, nil
 }
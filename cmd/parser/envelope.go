@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"text/template"
+)
+
+/*
+	Every template must render a JSON array of envelope entries, each one naming the file it should be written to,
+	and carrying a single OpenShift object as its content:
+
+		[{
+			"filename": "1-project.json",
+			"content": {
+				"kind": "Project",
+				"apiVersion": "project.openshift.io/v1",
+				"metadata": {
+					"name": "nic-test-backbase-reference"
+				}
+			}
+		}]
+
+	Anything else is rejected here, naming the template responsible, rather than being passed on to the output.
+*/
+
+// kinds which live outside of a namespace, and so must not carry metadata.namespace
+var clusterScopedKinds = map[string]bool{
+	"Namespace":                  true,
+	"Project":                    true,
+	"ClusterRole":                true,
+	"ClusterRoleBinding":         true,
+	"ClusterResourceQuota":       true,
+	"CustomResourceDefinition":   true,
+	"PersistentVolume":           true,
+	"PriorityClass":              true,
+	"SecurityContextConstraints": true,
+	"StorageClass":               true,
+}
+
+func isNamespaced(kind string) bool {
+	return !clusterScopedKinds[kind]
+}
+
+func getFilesFromTemplate(tpl *template.Template, data interface{}) ([]GeneratedFile, error) {
+
+	rendered, err := renderTemplate(tpl, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var result interface{}
+	if err := decodeRendered(tpl.Name(), rendered, &result); err != nil {
+		return nil, err
+	}
+	return validateEnvelope(tpl.Name(), result)
+}
+
+func validateEnvelope(name string, rendered interface{}) ([]GeneratedFile, error) {
+	items, ok := rendered.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("template %s must render a json array of {filename, content} objects, but rendered %s", name, jsonTypeName(rendered))
+	}
+
+	entries := make([]GeneratedFile, 0, len(items))
+	for i, item := range items {
+		entry, err := validateEntry(item)
+		if err != nil {
+			return nil, fmt.Errorf("template %s, entry %d: %s", name, i, err.Error())
+		}
+		entry.SourceTemplate = name
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func validateEntry(item interface{}) (GeneratedFile, error) {
+	entry := GeneratedFile{}
+
+	fields, ok := item.(map[string]interface{})
+	if !ok {
+		return entry, fmt.Errorf("must be an object, but is %s", jsonTypeName(item))
+	}
+	for key := range fields {
+		if key != "filename" && key != "content" {
+			return entry, fmt.Errorf("unexpected field %q, only filename and content are allowed", key)
+		}
+	}
+
+	filename, err := requiredString(fields, "filename")
+	if err != nil {
+		return entry, err
+	}
+	entry.Filename = filename
+
+	content, ok := fields["content"].(map[string]interface{})
+	if !ok {
+		return entry, fmt.Errorf("%s: content must be an object, but is %s", filename, jsonTypeName(fields["content"]))
+	}
+	if err := validateContent(content); err != nil {
+		return entry, fmt.Errorf("%s: %s", filename, err.Error())
+	}
+	entry.Content = content
+	return entry, nil
+}
+
+func validateContent(content map[string]interface{}) error {
+	if _, err := requiredString(content, "apiVersion"); err != nil {
+		return fmt.Errorf("content.%s", err.Error())
+	}
+	kind, err := requiredString(content, "kind")
+	if err != nil {
+		return fmt.Errorf("content.%s", err.Error())
+	}
+
+	metadata, ok := content["metadata"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("content.metadata must be an object, but is %s", jsonTypeName(content["metadata"]))
+	}
+	if _, err := requiredString(metadata, "name"); err != nil {
+		return fmt.Errorf("content.metadata.%s", err.Error())
+	}
+
+	_, hasNamespace := metadata["namespace"]
+	if isNamespaced(kind) {
+		if _, err := requiredString(metadata, "namespace"); err != nil {
+			return fmt.Errorf("content.metadata.%s for namespaced kind %s", err.Error(), kind)
+		}
+	} else if hasNamespace {
+		return fmt.Errorf("content.metadata.namespace must not be set for cluster scoped kind %s", kind)
+	}
+	return nil
+}
+
+func requiredString(fields map[string]interface{}, key string) (string, error) {
+	value, present := fields[key]
+	if !present {
+		return "", fmt.Errorf("%s is required", key)
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%s must be a string, but is %s", key, jsonTypeName(value))
+	}
+	if s == "" {
+		return "", fmt.Errorf("%s must not be empty", key)
+	}
+	return s, nil
+}
+
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case float64:
+		return "a number"
+	case string:
+		return "a string"
+	case []interface{}:
+		return "an array"
+	case map[string]interface{}:
+		return "an object"
+	}
+	return fmt.Sprintf("%T", value)
+}
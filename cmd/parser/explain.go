@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sort"
+	"text/template/parse"
+)
+
+/*
+	explain renders every template for a, possibly partial, input and reports each value that ended up being used,
+	where it came from, and which template used it:
+
+		parser explain -generate '{"optionals":[{"name":"cpu","count":2}]}'
+
+		[
+		  {"name": "cpu", "value": "2", "source": "input", "template": "quotas.txt.tmpl"},
+		  {"name": "memory", "value": "100Mi", "source": "profile", "profile": "defaults", "template": "quotas.txt.tmpl"},
+		  ...
+		]
+*/
+
+// where an effective value came from
+const (
+	sourceInput           = "input"
+	sourceProfile         = "profile" // the defaults file, see defaults.go
+	sourceTemplateDefault = "template default"
+	sourcePolicy          = "policy" // imposed by the parser itself, such as the placeholder for a missing project name
+)
+
+// stands in for whatever the partial input leaves out, as -show-quota always has
+const placeholderValue = "show-only"
+
+type explainedValue struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Source   string `json:"source"`
+	Profile  string `json:"profile,omitempty"` // which entry of the defaults file, such as prd/prd-east
+	Template string `json:"template,omitempty"`
+}
+
+type explainRecorder struct {
+	values []explainedValue
+	seen   map[string]bool
+}
+
+func newExplainRecorder() *explainRecorder {
+	return &explainRecorder{seen: make(map[string]bool)}
+}
+
+func (r *explainRecorder) record(value explainedValue) {
+	key := value.Name + "\x00" + value.Template
+	if r.seen[key] {
+		return
+	}
+	r.seen[key] = true
+	r.values = append(r.values, value)
+}
+
+type optionalGetter func(data *expectedInput, defaultValue interface{}) string
+
+func usesField(node parse.Node, field string) bool {
+	// reports whether field is referenced anywhere beneath node, as .Field, $data.Field and so on
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return false
+		}
+		for _, child := range n.Nodes {
+			if usesField(child, field) {
+				return true
+			}
+		}
+	case *parse.ActionNode:
+		return usesField(n.Pipe, field)
+	case *parse.PipeNode:
+		if n == nil {
+			return false
+		}
+		for _, cmd := range n.Cmds {
+			if usesField(cmd, field) {
+				return true
+			}
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			if usesField(arg, field) {
+				return true
+			}
+		}
+	case *parse.FieldNode:
+		return containsString(n.Ident, field)
+	case *parse.VariableNode:
+		return containsString(n.Ident, field)
+	case *parse.ChainNode:
+		return containsString(n.Field, field) || usesField(n.Node, field)
+	case *parse.IfNode:
+		return usesField(n.Pipe, field) || usesField(n.List, field) || usesField(n.ElseList, field)
+	case *parse.RangeNode:
+		return usesField(n.Pipe, field) || usesField(n.List, field) || usesField(n.ElseList, field)
+	case *parse.WithNode:
+		return usesField(n.Pipe, field) || usesField(n.List, field) || usesField(n.ElseList, field)
+	case *parse.TemplateNode:
+		return usesField(n.Pipe, field)
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func partialInput(payload string) (*expectedInput, map[string]bool, error) {
+	/*
+		decodes a partial input, filling in whatever is missing with the placeholder so that the usual validation can
+		still be applied to the rest. The returned map records which fields were given.
+	*/
+	given := map[string]bool{}
+	fields := map[string]interface{}{}
+	if payload != "" {
+		decoder := json.NewDecoder(bytes.NewReader([]byte(payload)))
+		decoder.UseNumber()
+		if err := decoder.Decode(&fields); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, name := range []string{"projectname", "environment"} {
+		if s, ok := fields[name].(string); ok && s != "" {
+			given[name] = true
+		} else {
+			fields[name] = placeholderValue
+		}
+	}
+
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return nil, nil, err
+	}
+	data := &expectedInput{}
+	if err := json.Unmarshal(b, data); err != nil {
+		return nil, nil, err
+	}
+	return data, given, nil
+}
+
+func (c *config) explain(data *expectedInput, given map[string]bool) ([]explainedValue, error) {
+	recorder := newExplainRecorder()
+	c.recorder = recorder
+	defer func() { c.recorder = nil }()
+
+	templates, err := c.getTemplates(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, tpl := range templates {
+		if _, err := c.createFiles(data, tpl); err != nil {
+			return nil, err
+		}
+		for field, name := range map[string]string{"ProjectName": "projectname", "Environment": "environment"} {
+			if tpl.Tree == nil || !usesField(tpl.Tree.Root, field) {
+				continue
+			}
+			value := explainedValue{Name: name, Value: data.ProjectName, Source: sourceInput, Template: tpl.Name()}
+			if name == "environment" {
+				value.Value = data.Environment
+			}
+			if !given[name] {
+				value.Source = sourcePolicy
+			}
+			recorder.record(value)
+		}
+	}
+
+	values := recorder.values
+	sort.SliceStable(values, func(i, j int) bool {
+		if values[i].Name != values[j].Name {
+			return values[i].Name < values[j].Name
+		}
+		return values[i].Template < values[j].Template
+	})
+	return values, nil
+}
+
+func runExplain(c *config, args []string) error {
+	flags := flag.NewFlagSet("explain", flag.ContinueOnError)
+	payload := flags.String("generate", "", "an optional, possibly partial, json payload to explain")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	data, given, err := partialInput(*payload)
+	if err != nil {
+		return fmt.Errorf("error in parsing input: %s", err.Error())
+	}
+	values, err := c.explain(data, given)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+/*
+	Commits the generated files into a local Git repository, bare or otherwise, beneath a path built from the input.
+
+	Only plumbing commands are used, against a private index file, so neither the working copy nor the index of a
+	non-bare repository is ever touched. The commit is made on its own branch, which is created from HEAD if it does
+	not exist yet. When the resulting tree is identical to the one already committed, no commit is made, though a
+	branch which does not exist yet is still created, pointing at HEAD.
+*/
+
+const (
+	defaultGitBranch = "parser/{{.ProjectName}}"
+	defaultGitPath   = "{{.Environment}}/{{.ProjectName}}"
+	defaultGitAuthor = "gobins parser <parser@gobins.local>"
+)
+
+var authorPattern = regexp.MustCompile(`^\s*([^<>]+?)\s*<([^<>]+)>\s*$`)
+
+type gitTarget struct {
+	repo   string // path to the repository, bare or a working copy
+	branch string // template for the branch name
+	path   string // template for the directory the bundle is written to
+	author string // "Name <email>"
+}
+
+type gitResult struct {
+	Branch  string `json:"branch"`
+	Path    string `json:"path"`
+	Commit  string `json:"commit"`
+	Changed bool   `json:"changed"`
+}
+
+// the values available to the branch and path templates
+type gitLayoutData struct {
+	ProjectName string
+	Environment string
+	InputHash   string
+}
+
+type gitRepo struct {
+	dir   string
+	index string
+	env   []string
+}
+
+func (r *gitRepo) run(stdin []byte, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", r.dir}, args...)...)
+	cmd.Env = append(os.Environ(), r.env...)
+	if r.index != "" {
+		cmd.Env = append(cmd.Env, "GIT_INDEX_FILE="+r.index)
+	}
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %s: %s", args[0], err.Error(), strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func (r *gitRepo) resolve(ref string) string {
+	// returns the commit ref points at, or "" when it does not exist
+	commit, err := r.run(nil, "rev-parse", "--verify", "-q", ref+"^{commit}")
+	if err != nil {
+		return ""
+	}
+	return commit
+}
+
+func (r *gitRepo) nullID() (string, error) {
+	// the all zero object id, as long as the repository's hashes, which older versions of git only know as sha1
+	format, err := r.run(nil, "rev-parse", "--show-object-format")
+	if err != nil || format == "" || format == "--show-object-format" {
+		format = "sha1"
+	}
+	switch format {
+	case "sha1":
+		return strings.Repeat("0", 40), nil
+	case "sha256":
+		return strings.Repeat("0", 64), nil
+	}
+	return "", fmt.Errorf("unsupported object format %s", format)
+}
+
+func renderLayout(name, text string, data gitLayoutData) (string, error) {
+	tpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s template: %s", name, err.Error())
+	}
+	var b bytes.Buffer
+	if err := tpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("invalid %s template: %s", name, err.Error())
+	}
+	return b.String(), nil
+}
+
+func parseAuthor(author string) (string, string, error) {
+	match := authorPattern.FindStringSubmatch(author)
+	if match == nil {
+		return "", "", fmt.Errorf("author must be of the form \"Name <email>\": %s", author)
+	}
+	return match[1], match[2], nil
+}
+
+func (files GeneratedFiles) commitToGit(target gitTarget, data *expectedInput, flat bool) (gitResult, error) {
+	result := gitResult{}
+	if err := validGitTarget(target); err != nil {
+		return result, err
+	}
+
+	layout := gitLayoutData{ProjectName: data.ProjectName, Environment: data.Environment, InputHash: data.hash()}
+	branch, err := renderLayout("branch", target.branch, layout)
+	if err != nil {
+		return result, err
+	}
+	bundlePath, err := renderLayout("path", target.path, layout)
+	if err != nil {
+		return result, err
+	}
+	bundlePath = path.Clean(strings.Trim(bundlePath, "/"))
+	if bundlePath == "." || bundlePath == ".." || strings.HasPrefix(bundlePath, "../") {
+		return result, fmt.Errorf("path %s is outside of the repository", bundlePath)
+	}
+	result.Branch = branch
+	result.Path = bundlePath
+
+	name, email, err := parseAuthor(target.author)
+	if err != nil {
+		return result, err
+	}
+
+	repo := &gitRepo{
+		dir: target.repo,
+		env: []string{
+			"GIT_AUTHOR_NAME=" + name, "GIT_AUTHOR_EMAIL=" + email,
+			"GIT_COMMITTER_NAME=" + name, "GIT_COMMITTER_EMAIL=" + email,
+		},
+	}
+	if _, err := repo.run(nil, "check-ref-format", "--branch", branch); err != nil {
+		return result, fmt.Errorf("invalid branch name %s", branch)
+	}
+	ref := "refs/heads/" + branch
+
+	bare, err := repo.run(nil, "rev-parse", "--is-bare-repository")
+	if err != nil {
+		return result, err
+	}
+	if bare != "true" {
+		// moving the checked out branch underneath a working copy would leave it looking modified
+		if head, _ := repo.run(nil, "symbolic-ref", "-q", "HEAD"); head == ref {
+			return result, fmt.Errorf("branch %s is checked out in %s", branch, target.repo)
+		}
+	}
+
+	null, err := repo.nullID()
+	if err != nil {
+		return result, err
+	}
+	current := repo.resolve(ref)
+	parent := current
+	if parent == "" {
+		parent = repo.resolve("HEAD")
+	}
+
+	indexDir, err := ioutil.TempDir("", "parser-index-")
+	if err != nil {
+		return result, err
+	}
+	defer os.RemoveAll(indexDir)
+	repo.index = filepath.Join(indexDir, "index")
+
+	if parent != "" {
+		if _, err := repo.run(nil, "read-tree", parent); err != nil {
+			return result, err
+		}
+	} else if _, err := repo.run(nil, "read-tree", "--empty"); err != nil {
+		return result, err
+	}
+
+	// the bundle path is replaced wholesale, so files no longer generated disappear with it
+	var entries bytes.Buffer
+	if parent != "" {
+		existing, err := repo.run(nil, "ls-tree", "-r", "--name-only", parent, "--", bundlePath)
+		if err != nil {
+			return result, err
+		}
+		for _, name := range strings.Split(existing, "\n") {
+			if name != "" {
+				fmt.Fprintf(&entries, "0 %s\t%s\n", null, name)
+			}
+		}
+	}
+	for _, file := range files {
+		if _, err := safeJoin(bundlePath, file.Filename); err != nil {
+			return result, fmt.Errorf("template %s: %s", file.SourceTemplate, err.Error())
+		}
+		b, err := file.contentBytes(flat)
+		if err != nil {
+			return result, err
+		}
+		blob, err := repo.run(b, "hash-object", "-w", "--stdin")
+		if err != nil {
+			return result, err
+		}
+		fmt.Fprintf(&entries, "100644 %s\t%s\n", blob, path.Join(bundlePath, path.Clean(file.Filename)))
+	}
+	if _, err := repo.run(entries.Bytes(), "update-index", "--index-info"); err != nil {
+		return result, err
+	}
+
+	tree, err := repo.run(nil, "write-tree")
+	if err != nil {
+		return result, err
+	}
+	if parent != "" {
+		parentTree, err := repo.run(nil, "rev-parse", parent+"^{tree}")
+		if err != nil {
+			return result, err
+		}
+		if parentTree == tree {
+			if current == "" {
+				// nothing to commit, but the branch is still expected to exist afterwards
+				if _, err := repo.run(nil, "update-ref", "-m", "parser: "+data.ProjectName, ref, parent, null); err != nil {
+					return result, err
+				}
+			}
+			result.Commit = parent
+			return result, nil
+		}
+	}
+
+	message := fmt.Sprintf("Update %s in %s\n\nGenerated by parser from input sha256:%s\n", data.ProjectName, data.Environment, layout.InputHash)
+	args := []string{"commit-tree", tree, "-F", "-"}
+	if parent != "" {
+		args = append(args, "-p", parent)
+	}
+	commit, err := repo.run([]byte(message), args...)
+	if err != nil {
+		return result, err
+	}
+
+	// only move the branch if nobody else has in the meantime
+	old := current
+	if old == "" {
+		old = null
+	}
+	if _, err := repo.run(nil, "update-ref", "-m", "parser: "+data.ProjectName, ref, commit, old); err != nil {
+		return result, err
+	}
+	result.Commit = commit
+	result.Changed = true
+	return result, nil
+}
+
+func validGitTarget(target gitTarget) error {
+	if target.repo == "" {
+		return errors.New("missing git repository")
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return errors.New("git is required to commit to a repository, but was not found")
+	}
+	return nil
+}
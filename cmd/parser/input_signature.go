@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+/*
+	Optionally, the payload passed to -generate must be signed by one of a set of trusted keys before anything is
+	generated from it. The signature travels inside the payload itself:
+
+		{
+			"projectname": "nic-test-backbase-reference",
+			"environment": "dev",
+			"optionals": [...],
+			"signature": {
+				"keyid": "portal-1",
+				"value": "<base64 ed25519 signature>"
+			}
+		}
+
+	and covers the canonical JSON of everything else in the payload: compact, with object keys sorted, and without
+	the signature field.
+
+	The keyring maps key ids to base64 encoded raw ed25519 public keys:
+
+		{"keys": [{"keyid": "portal-1", "publickey": "<base64 32 byte key>"}]}
+*/
+
+const inputSignatureField = "signature"
+
+type inputSignature struct {
+	KeyID string `json:"keyid"`
+	Value string `json:"value"`
+}
+
+type keyring struct {
+	Keys []struct {
+		KeyID     string `json:"keyid"`
+		PublicKey string `json:"publickey"`
+	} `json:"keys"`
+}
+
+func loadKeyring(filename string) (map[string]ed25519.PublicKey, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var ring keyring
+	if err := json.Unmarshal(b, &ring); err != nil {
+		return nil, fmt.Errorf("invalid keyring %s: %s", filename, err.Error())
+	}
+	keys := make(map[string]ed25519.PublicKey)
+	for _, k := range ring.Keys {
+		raw, err := base64.StdEncoding.DecodeString(k.PublicKey)
+		if err != nil || len(raw) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid keyring %s: key %s is not a base64 encoded ed25519 public key", filename, k.KeyID)
+		}
+		keys[k.KeyID] = ed25519.PublicKey(raw)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("invalid keyring %s: no keys", filename)
+	}
+	return keys, nil
+}
+
+func canonicalInput(payload []byte) ([]byte, *inputSignature, error) {
+	// splits a signed payload into the bytes which were signed, and the signature
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	var fields map[string]interface{}
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, nil, err
+	}
+
+	raw, present := fields[inputSignatureField]
+	if !present {
+		return nil, nil, errors.New("input is not signed")
+	}
+	delete(fields, inputSignatureField)
+
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	signature := &inputSignature{}
+	if err := json.Unmarshal(b, signature); err != nil || signature.KeyID == "" || signature.Value == "" {
+		return nil, nil, errors.New("input signature must carry a keyid and a value")
+	}
+
+	canonical, err := json.Marshal(fields)
+	if err != nil {
+		return nil, nil, err
+	}
+	return canonical, signature, nil
+}
+
+func verifyInput(payload []byte, keys map[string]ed25519.PublicKey) error {
+	canonical, signature, err := canonicalInput(payload)
+	if err != nil {
+		return err
+	}
+	key, trusted := keys[signature.KeyID]
+	if !trusted {
+		return errors.New("input is signed by an untrusted key: " + signature.KeyID)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(signature.Value)
+	if err != nil {
+		return errors.New("input signature is not valid base64")
+	}
+	if !ed25519.Verify(key, canonical, decoded) {
+		return errors.New("input signature does not match its content")
+	}
+	return nil
+}
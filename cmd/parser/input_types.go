@@ -1,8 +1,11 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"sort"
 	"strings"
 )
 
@@ -107,6 +110,37 @@ func (o *oUnit) UnmarshalJSON(data []byte) error {
 
 }
 
+func (o oName) MarshalJSON() ([]byte, error) {
+	return json.Marshal(o.string)
+}
+
+func (o oCount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(o.int)
+}
+
+func (o oUnit) MarshalJSON() ([]byte, error) {
+	return json.Marshal(o.string)
+}
+
+func (input *expectedInput) hash() string {
+	/*
+		sha256 of the normalized input: already lowercased by the decoder, and with the optionals sorted by name,
+		so that two requests asking for the same thing always hash the same, regardless of how they were written.
+	*/
+	normalized := *input
+	normalized.Optionals = append([]optionalObject{}, input.Optionals...)
+	sort.SliceStable(normalized.Optionals, func(i, j int) bool {
+		return normalized.Optionals[i].Name.string < normalized.Optionals[j].Name.string
+	})
+	b, err := json.Marshal(normalized)
+	if err != nil {
+		// only ever strings and ints, so this cannot happen
+		panic(err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
 func (input *expectedInput) getOptional(name string) *optionalObject {
 	// simple helper that looks for, and then returns an optionalObject with a name that matches name
 	for _, object := range input.Optionals {
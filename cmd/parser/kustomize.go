@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"path"
+	"path/filepath"
+)
+
+/*
+	Writes the generated objects as a Kustomize base, one directory per project:
+
+		<out>/<projectname>/base/kustomization.yaml
+		<out>/<projectname>/base/1-project.json
+		...
+		<out>/<projectname>/overlays/<environment>/kustomization.yaml
+
+	The overlays are only skeletons which refer back to the base, and are intended to be edited by hand, so they are
+	never overwritten once they exist.
+*/
+
+const (
+	kustomizeAPIVersion = "kustomize.config.k8s.io/v1beta1"
+	kustomizationFile   = "kustomization.yaml"
+)
+
+func kustomizeLabels(data *expectedInput) map[string]interface{} {
+	return map[string]interface{}{
+		managedByLabel:   managedByValue,
+		projectLabel:     data.ProjectName,
+		environmentLabel: data.Environment,
+	}
+}
+
+func (files GeneratedFiles) kustomization(data *expectedInput) GeneratedFile {
+	var resources []interface{}
+	for _, file := range files.objects().inApplyOrder() {
+		resources = append(resources, file.Filename)
+	}
+	return GeneratedFile{
+		Filename:       kustomizationFile,
+		SourceTemplate: "kustomize",
+		Content: map[string]interface{}{
+			"apiVersion": kustomizeAPIVersion,
+			"kind":       "Kustomization",
+			"namespace":  data.ProjectName,
+			// commonLabels would also rewrite selectors, narrowing default-deny-all to only the labelled pods
+			"labels": []interface{}{
+				map[string]interface{}{
+					"pairs":            kustomizeLabels(data),
+					"includeSelectors": false,
+				},
+			},
+			"resources": resources,
+		},
+	}
+}
+
+func overlaySkeleton() GeneratedFile {
+	return GeneratedFile{
+		Filename:       kustomizationFile,
+		SourceTemplate: "kustomize",
+		Content: map[string]interface{}{
+			"apiVersion": kustomizeAPIVersion,
+			"kind":       "Kustomization",
+			"resources":  []interface{}{"../../base"},
+		},
+	}
+}
+
+func (files GeneratedFiles) writeKustomize(dir string, data *expectedInput, overlays []string, policy string, flat bool) (writeResult, error) {
+	result := writeResult{Written: []string{}, Skipped: []string{}}
+	if data.ProjectName == "" {
+		return result, errors.New("kustomize output requires a project name")
+	}
+	projectDir, err := safeJoin(dir, data.ProjectName)
+	if err != nil {
+		return result, err
+	}
+
+	base := append(GeneratedFiles{}, files...)
+	base = append(base, files.kustomization(data))
+	written, err := base.writeDir(filepath.Join(projectDir, "base"), policy, flat)
+	if err != nil {
+		return result, err
+	}
+	result.add("base", written)
+
+	for _, overlay := range overlays {
+		overlayDir, err := safeJoin(filepath.Join(projectDir, "overlays"), overlay)
+		if err != nil {
+			return result, err
+		}
+		written, err := GeneratedFiles{overlaySkeleton()}.writeDir(overlayDir, existingSkip, flat)
+		if err != nil {
+			return result, err
+		}
+		result.add(path.Join("overlays", overlay), written)
+	}
+	return result, nil
+}
+
+func (r *writeResult) add(prefix string, other writeResult) {
+	for _, name := range other.Written {
+		r.Written = append(r.Written, path.Join(prefix, name))
+	}
+	for _, name := range other.Skipped {
+		r.Skipped = append(r.Skipped, path.Join(prefix, name))
+	}
+}
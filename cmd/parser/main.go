@@ -87,98 +87,83 @@ func quoteString(s string) string {
 	return "\"" + s + "\""
 }
 
-func (c *config) createJSONBytes(data *expectedInput, tpl *template.Template) ([]byte, error) {
+func (c *config) createFiles(data *expectedInput, tpl *template.Template) ([]GeneratedFile, error) {
 
-	unknown := getInterfaceFromTemplate(tpl, data)
-	if c.flatOutput {
-		bytes, err := json.Marshal(unknown)
-		if err != nil {
-			return nil, err
-		}
-		return bytes, nil
-	}
-	bytes, err := json.MarshalIndent(unknown, "", "  ")
+	files, err := getFilesFromTemplate(tpl, data)
 	if err != nil {
 		return nil, err
 	}
-	return bytes, nil
-
+	if err := c.checkTypes(files); err != nil {
+		return nil, err
+	}
+	return files, nil
 }
 
 func concat(i int, s string) string {
 	return strconv.Itoa(i) + s
 }
 
-func rangeBetweenBrackets(results []byte) []byte {
-	// given a slice with '[' as the first char, returns the next, all the way to the second from last, the closing ']'
-	if results[0] == byte('[') {
-		return results[1 : len(results)-2]
-	}
-	return results
-}
-
-func (c *config) getTemplates(data *expectedInput) []*template.Template {
+func (c *config) getTemplates(data *expectedInput) ([]*template.Template, error) {
 	var templates []*template.Template
 	if c.usefileContentInput {
-		tpl := getTemplateFromString("raw_stream", c.fileContent, getFuncMap())
+		tpl, err := getTemplateFromString("raw_stream", c.fileContent, c.funcMap("raw_stream"))
+		if err != nil {
+			return nil, err
+		}
 		templates = append(templates, tpl)
-		return templates
+		return templates, nil
 	}
 	for _, fileName := range c.fileList {
-		tpl := getTemplateFromFile(fileName, c.templateDir+fileName, getFuncMap())
-		templates = append(templates, tpl)
-	}
-	return templates
-}
-
-func (c *config) process(data *expectedInput) ([]byte, error) {
-
-	var results []byte
-	// as returning a JSON slice, add first and last brackets
-	results = append(results, byte('['))
-
-	// grab templates
-	templates := c.getTemplates(data)
-	for i, t := range templates {
-		tempBytes, err := c.createJSONBytes(data, t)
+		tpl, err := getTemplateFromFile(fileName, c.templateDir+fileName, c.funcMap(fileName))
 		if err != nil {
 			return nil, err
 		}
-		for _, b := range rangeBetweenBrackets(tempBytes) {
-			results = append(results, b)
-		}
-		// add a comma to the output unless we're the last
-		if i < len(templates)-1 {
-			results = append(results, byte(','))
-		}
-
+		templates = append(templates, tpl)
 	}
-	results = append(results, byte(']'))
-	return results, nil
+	return templates, nil
 }
 
-func (c *config) show() ([]byte, error) {
-	data := &expectedInput{ProjectName: "show-only"}
-	var results []byte
-	// as returning a JSON slice, add first and last brackets
-	results = append(results, byte('['))
+func (c *config) generate(data *expectedInput) (GeneratedFiles, error) {
 
 	// grab templates
-	templates := c.getTemplates(data)
+	templates, err := c.getTemplates(data)
+	if err != nil {
+		return nil, err
+	}
+	collisions := newCollisionTracker()
+	var results GeneratedFiles
 	for _, t := range templates {
-		tempBytes, err := c.createJSONBytes(data, t)
+		files, err := c.createFiles(data, t)
 		if err != nil {
 			return nil, err
 		}
-		for _, b := range rangeBetweenBrackets(tempBytes) {
-			results = append(results, b)
-		}
-
+		collisions.add(files)
+		results = append(results, files...)
+	}
+	if err := collisions.err(); err != nil {
+		return nil, err
+	}
+	if c.templateSet != "" {
+		results.stampTemplateSet(c.templateSet)
+	}
+	if c.provenance {
+		return c.addProvenance(data, results)
 	}
-	results = append(results, byte(']'))
 	return results, nil
 }
 
+func (c *config) process(data *expectedInput) ([]byte, error) {
+	results, err := c.generate(data)
+	if err != nil {
+		return nil, err
+	}
+	return results.serialize(c.outputFormat, c.flatOutput)
+}
+
+func (c *config) show() ([]byte, error) {
+	return c.process(&expectedInput{ProjectName: "show-only"})
+}
+
 /*
 	Helpers
 */
@@ -191,11 +176,31 @@ func logFunction(format string) {
 var exitLog = logFunction
 
 type config struct {
-	usefileContentInput bool
-	flatOutput          bool
-	templateDir         string
-	fileList            []string
-	fileContent         string // optional, allows testing, and runtime funkiness if required
+	usefileContentInput    bool
+	flatOutput             bool
+	allowUnregisteredKinds bool     // generated kinds unknown to the typed scheme are passed through unchecked
+	outputFormat           string   // how the generated objects are written to STDOUT, envelope, list or yaml
+	outputDir              string   // when set, each generated object is written to its own file beneath it
+	overlays               []string // environments given an overlay skeleton by the kustomize format
+	git                    gitTarget
+	apply                  bool // apply the generated objects to the cluster in kube, with server-side apply
+	kube                   clusterTarget
+	fieldManager           string
+	forceConflicts         bool
+	templateSet            string // labels every object as belonging to this set of templates, which prune relies on
+	prune                  bool   // delete labelled objects in the project's namespace that are no longer generated
+	pruneDryRun            bool
+	provenance             bool   // stamp every object with, and write out, what produced it
+	signKey                string // PEM encoded ed25519 private key the bundle is signed with
+	signatureOut           string // where the detached signature is written, alongside the bundle when unset
+	inputKeyring           string // when set, the input must be signed by one of the keys in it
+	existingFiles          string // overwrite, skip or fail when a file in outputDir already exists
+	templateDir            string
+	fileList               []string
+	fileContent            string        // optional, allows testing, and runtime funkiness if required
+	defaults               *defaultsFile // consulted for optionals the input leaves out
+	cluster                string        // selects the cluster specific defaults, if any
+	recorder               *explainRecorder
 }
 
 func stringToSlice(name string) []string {
@@ -216,9 +221,9 @@ func getConfig(fileContent string) (*config, error) {
 			if fileContent == "" {
 				return nil, errors.New("environment variables undefined")
 			}
-			return &config{usefileContentInput: true, fileContent: fileContent}, nil
+			return withDefaults(&config{usefileContentInput: true, fileContent: fileContent})
 		}
-		return &config{fileList: stringToSlice(flist)}, nil
+		return withDefaults(&config{fileList: stringToSlice(flist)})
 	}
 	// ensure tdir ends with a "/"
 	if tdir[len(tdir)-1] != '/' {
@@ -227,23 +232,66 @@ func getConfig(fileContent string) (*config, error) {
 	if flist == "" {
 		return nil, errors.New("environment variables undefined")
 	}
-	return &config{templateDir: tdir, fileList: stringToSlice(flist)}, nil
+	return withDefaults(&config{templateDir: tdir, fileList: stringToSlice(flist)})
+
+}
 
+func withDefaults(c *config) (*config, error) {
+	c.cluster = strings.ToLower(removeSpaces(os.Getenv("CLUSTER_NAME")))
+	filename := defaultsFilename(c.templateDir)
+	if filename == "" {
+		defaults, err := parseDefaults("built in defaults", []byte(builtinDefaults))
+		c.defaults = defaults
+		return c, err
+	}
+	defaults, err := loadDefaults(filename)
+	if err != nil {
+		return nil, err
+	}
+	c.defaults = defaults
+	return c, nil
 }
 
 func main() {
 
-	config, err := getConfig("")
-	if err != nil {
-		exitLog("program exited due to error: " + err.Error())
+	if len(os.Args) > 1 && runSubcommand(os.Args[1], os.Args[2:]) {
+		os.Exit(0)
 	}
 
+	config := mustGetConfig()
+
 	var incomingJSON *string
 	var boolPtr *bool
 	incomingJSON = flag.String("generate", "", "the json payload used to generate the OpenShift json")
-	boolPtr = flag.Bool("show-quota", false, "if used, displays the default quotas that will be applied")
+	boolPtr = flag.Bool("show-quota", false, "deprecated, use the explain command instead. If used, displays the default quotas that will be applied")
+	flag.BoolVar(&config.allowUnregisteredKinds, "allow-unregistered-kinds", false, "if used, generated kinds that cannot be type checked are passed through")
+	flag.StringVar(&config.outputFormat, "output", outputEnvelope, "the format written to STDOUT: envelope, list for a v1 List that can be piped to oc apply -f -, or yaml. With -out, kustomize writes a base per project")
+	overlays := flag.String("overlays", "", "comma separated environments to create kustomize overlay skeletons for")
+	flag.BoolVar(&config.provenance, "provenance", false, "if used, records the parser version, template digests, input hash and time in provenance.json and on every object")
+	flag.StringVar(&config.signKey, "sign-key", "", "if used, signs the generated bundle with this PEM encoded ed25519 private key. Not available for list or yaml output to STDOUT")
+	flag.StringVar(&config.signatureOut, "signature", "", "file the detached signature is written to, required when writing to STDOUT. Defaults to "+signatureFile+" within the bundle")
+	flag.StringVar(&config.inputKeyring, "input-keyring", "", "if used, the -generate payload must carry a signature from one of the keys in this keyring")
+	flag.StringVar(&config.git.repo, "git-repo", "", "if used, commits the generated objects into this local git repository, bare or a working copy")
+	flag.StringVar(&config.git.branch, "git-branch", defaultGitBranch, "template for the branch committed to, given .ProjectName, .Environment and .InputHash")
+	flag.StringVar(&config.git.path, "git-path", defaultGitPath, "template for the directory within the repository the objects are written to")
+	flag.StringVar(&config.git.author, "git-author", defaultGitAuthor, "author and committer of the commit, as \"Name <email>\"")
+	flag.BoolVar(&config.apply, "apply", false, "if used, applies the generated objects to the cluster with server-side apply, reporting what happened to each. Runs before -git-repo and -out when combined")
+	flag.StringVar(&config.kube.kubeconfig, "kubeconfig", "", "absolute path to the kubeconfig file used by -apply")
+	flag.StringVar(&config.kube.context, "context", "", "the context within the kubeconfig used by -apply")
+	flag.BoolVar(&config.kube.local, "local", false, "with -apply, use the pod's service account rather than a kubeconfig")
+	flag.StringVar(&config.fieldManager, "field-manager", defaultFieldManager, "the field manager -apply applies as")
+	flag.BoolVar(&config.forceConflicts, "force-conflicts", false, "with -apply, take ownership of fields managed by others rather than failing")
+	flag.StringVar(&config.templateSet, "template-set", "", "if used, labels every generated object as managed by the parser and belonging to this set of templates")
+	flag.BoolVar(&config.prune, "prune", false, "with -template-set, deletes labelled objects in the project's namespace which are no longer generated. Runs after -apply when both are used")
+	flag.BoolVar(&config.pruneDryRun, "prune-dry-run", false, "with -prune, only reports what would be deleted")
+	flag.StringVar(&config.outputDir, "out", "", "if used, writes each generated object to its filename beneath this directory")
+	flag.StringVar(&config.existingFiles, "on-exist", existingFail, "what to do with files already present in the -out directory: overwrite, skip or fail")
 	flag.Parse()
 
+	if *overlays != "" {
+		config.overlays = stringToSlice(*overlays)
+	}
+
 	if *boolPtr {
 		// modify the config's filelist to ONLY include the one for quotas
 		newFileList := make([]string, 1)
@@ -263,19 +311,79 @@ func main() {
 		os.Exit(0)
 	}
 
-	if *incomingJSON == "" {
-		exitLog("program exited due to missing input")
+	inputData, err := config.loadInput(*incomingJSON)
+	if err != nil {
+		exitLog("program exited due to " + err.Error())
 	}
 
-	var inputData expectedInput
-	// unmarshal will call our custom decoders which do input verification
-	err = json.Unmarshal([]byte(*incomingJSON), &inputData)
+	// lets go
+	files, err := config.generate(inputData)
 	if err != nil {
-		exitLog("program exited due to error in parsing input: " + err.Error())
+		exitLog("program exited due to error: " + err.Error())
+	}
+	if config.signKey != "" {
+		files, err = config.signBundle(files)
+		if err != nil {
+			exitLog("program exited due to error in signing output: " + err.Error())
+		}
 	}
 
-	// lets go
-	rawResults, err := config.process(&inputData)
+	if config.prune && config.templateSet == "" {
+		exitLog("program exited due to error: -prune requires -template-set")
+	}
+
+	// apply, prune, -git-repo and -out may be combined, and replace writing the bundle to STDOUT
+	written := false
+	if config.apply || config.prune {
+		a, err := newApplier(config.kube, config.fieldManager, config.forceConflicts)
+		if err != nil {
+			exitLog("program exited due to error: " + err.Error())
+		}
+		if config.apply {
+			results, err := a.apply(files)
+			printSummary(results)
+			if err != nil {
+				exitLog("program exited due to error in applying output: " + err.Error())
+			}
+		}
+		if config.prune {
+			results, err := a.prune(files, inputData.namespace(), config.templateSet, config.pruneDryRun)
+			printSummary(results)
+			if err != nil {
+				exitLog("program exited due to error in pruning: " + err.Error())
+			}
+		}
+		written = true
+	}
+
+	if config.git.repo != "" {
+		result, err := files.commitToGit(config.git, inputData, config.flatOutput)
+		if err != nil {
+			exitLog("program exited due to error in committing output: " + err.Error())
+		}
+		printSummary(result)
+		written = true
+	}
+
+	if config.outputDir != "" {
+		var result writeResult
+		if config.outputFormat == outputKustomize {
+			result, err = files.writeKustomize(config.outputDir, inputData, config.overlays, config.existingFiles, config.flatOutput)
+		} else {
+			result, err = files.writeDir(config.outputDir, config.existingFiles, config.flatOutput)
+		}
+		if err != nil {
+			exitLog("program exited due to error in writing output: " + err.Error())
+		}
+		printSummary(result)
+		written = true
+	}
+
+	if written {
+		os.Exit(0)
+	}
+
+	rawResults, err := files.serialize(config.outputFormat, config.flatOutput)
 	if err != nil {
 		exitLog("program exited due to error: " + err.Error())
 	}
@@ -284,3 +392,11 @@ func main() {
 	fmt.Println(string(rawResults))
 
 }
+
+func printSummary(summary interface{}) {
+	b, err := json.Marshal(summary)
+	if err != nil {
+		exitLog("program exited due to error: " + err.Error())
+	}
+	fmt.Println(string(b))
+}
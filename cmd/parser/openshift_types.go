@@ -0,0 +1,100 @@
+package main
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+/*
+	OpenShift objects generated by our templates, which are not part of k8s.io/api.
+	Rather than pull in the whole of github.com/openshift/api, only the fields of the kinds we emit are mirrored here,
+	which is enough for them to be decoded strictly alongside the upstream Kubernetes types.
+*/
+
+var (
+	projectGroupVersion = schema.GroupVersion{Group: "project.openshift.io", Version: "v1"}
+	networkGroupVersion = schema.GroupVersion{Group: "network.openshift.io", Version: "v1"}
+)
+
+type Project struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ProjectSpec   `json:"spec,omitempty"`
+	Status ProjectStatus `json:"status,omitempty"`
+}
+
+type ProjectSpec struct {
+	Finalizers []corev1.FinalizerName `json:"finalizers,omitempty"`
+}
+
+type ProjectStatus struct {
+	Phase      corev1.NamespacePhase       `json:"phase,omitempty"`
+	Conditions []corev1.NamespaceCondition `json:"conditions,omitempty"`
+}
+
+type EgressNetworkPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec EgressNetworkPolicySpec `json:"spec"`
+}
+
+type EgressNetworkPolicySpec struct {
+	Egress []EgressNetworkPolicyRule `json:"egress"`
+}
+
+type EgressNetworkPolicyRule struct {
+	Type string                  `json:"type"`
+	To   EgressNetworkPolicyPeer `json:"to"`
+}
+
+type EgressNetworkPolicyPeer struct {
+	CIDRSelector string `json:"cidrSelector,omitempty"`
+	DNSName      string `json:"dnsName,omitempty"`
+}
+
+func addOpenShiftTypes(scheme *runtime.Scheme) error {
+	scheme.AddKnownTypes(projectGroupVersion, &Project{})
+	scheme.AddKnownTypes(networkGroupVersion, &EgressNetworkPolicy{})
+	metav1.AddToGroupVersion(scheme, projectGroupVersion)
+	metav1.AddToGroupVersion(scheme, networkGroupVersion)
+	return nil
+}
+
+func (in *Project) DeepCopyObject() runtime.Object {
+	if in == nil {
+		return nil
+	}
+	out := new(Project)
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	if in.Spec.Finalizers != nil {
+		out.Spec.Finalizers = make([]corev1.FinalizerName, len(in.Spec.Finalizers))
+		copy(out.Spec.Finalizers, in.Spec.Finalizers)
+	}
+	out.Status.Phase = in.Status.Phase
+	if in.Status.Conditions != nil {
+		out.Status.Conditions = make([]corev1.NamespaceCondition, len(in.Status.Conditions))
+		for i := range in.Status.Conditions {
+			in.Status.Conditions[i].DeepCopyInto(&out.Status.Conditions[i])
+		}
+	}
+	return out
+}
+
+func (in *EgressNetworkPolicy) DeepCopyObject() runtime.Object {
+	if in == nil {
+		return nil
+	}
+	out := new(EgressNetworkPolicy)
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	if in.Spec.Egress != nil {
+		out.Spec.Egress = make([]EgressNetworkPolicyRule, len(in.Spec.Egress))
+		copy(out.Spec.Egress, in.Spec.Egress)
+	}
+	return out
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+)
+
+/*
+	Provenance records which parser build, which templates and which input produced a bundle. It is written alongside
+	the generated objects as provenance.json, and stamped onto every object as annotations, so that anything found in
+	a cluster can be traced back to where it came from.
+*/
+
+// set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+const provenanceFile = "provenance.json"
+
+const (
+	versionAnnotation     = "gobins.io/generator-version"
+	templateAnnotation    = "gobins.io/template-sha256"
+	inputAnnotation       = "gobins.io/input-sha256"
+	generatedAtAnnotation = "gobins.io/generated-at"
+)
+
+type provenanceRecord struct {
+	GeneratorVersion string            `json:"generatorVersion"`
+	Templates        map[string]string `json:"templates"`
+	InputHash        string            `json:"inputHash"`
+	Timestamp        string            `json:"timestamp"`
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *config) templateDigests() (map[string]string, error) {
+	digests := make(map[string]string)
+	if c.usefileContentInput {
+		digests["raw_stream"] = sha256Hex([]byte(c.fileContent))
+		return digests, nil
+	}
+	for _, fileName := range c.fileList {
+		b, err := ioutil.ReadFile(c.templateDir + fileName)
+		if err != nil {
+			return nil, fmt.Errorf("error in reading template from file %s: %s", c.templateDir+fileName, err.Error())
+		}
+		digests[fileName] = sha256Hex(b)
+	}
+	return digests, nil
+}
+
+func generatedAt() (string, error) {
+	// honour SOURCE_DATE_EPOCH, so that regenerating an unchanged bundle can produce identical output
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		seconds, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid SOURCE_DATE_EPOCH: %s", epoch)
+		}
+		return time.Unix(seconds, 0).UTC().Format(time.RFC3339), nil
+	}
+	return time.Now().UTC().Format(time.RFC3339), nil
+}
+
+func (c *config) addProvenance(data *expectedInput, files GeneratedFiles) (GeneratedFiles, error) {
+	digests, err := c.templateDigests()
+	if err != nil {
+		return nil, err
+	}
+	timestamp, err := generatedAt()
+	if err != nil {
+		return nil, err
+	}
+	record := provenanceRecord{
+		GeneratorVersion: version,
+		Templates:        digests,
+		InputHash:        data.hash(),
+		Timestamp:        timestamp,
+	}
+
+	for _, file := range files {
+		if file.Filename == provenanceFile {
+			return nil, fmt.Errorf("template %s: filename %s is reserved for provenance", file.SourceTemplate, provenanceFile)
+		}
+		annotations := file.annotations()
+		annotations[versionAnnotation] = record.GeneratorVersion
+		annotations[templateAnnotation] = digests[file.SourceTemplate]
+		annotations[inputAnnotation] = record.InputHash
+		annotations[generatedAtAnnotation] = record.Timestamp
+	}
+
+	return append(files, GeneratedFile{Filename: provenanceFile, Content: record, SourceTemplate: "provenance"}), nil
+}
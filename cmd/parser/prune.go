@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+/*
+	With -template-set, every generated object is labelled as managed by the parser, and as belonging to that set of
+	templates. Pruning lists the labelled objects in the project's namespace, and deletes those the current bundle no
+	longer contains, such as the RoleBinding of a template which has since been removed.
+
+	An object annotated with gobins.io/prune-protected: "true" is never pruned, and a dry run only reports what
+	would have been.
+*/
+
+const pruneProtectedAnnotation = "gobins.io/prune-protected"
+
+// what pruning did, or would do, to an object
+const (
+	prunePruned     = "pruned"
+	pruneWouldPrune = "would prune"
+	pruneProtected  = "protected"
+)
+
+// kinds looked at even when the current bundle no longer produces any of them
+var pruneKinds = []schema.GroupVersionKind{
+	{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "RoleBinding"},
+	{Version: "v1", Kind: "ResourceQuota"},
+	{Version: "v1", Kind: "LimitRange"},
+	{Group: "networking.k8s.io", Version: "v1", Kind: "NetworkPolicy"},
+	{Group: "network.openshift.io", Version: "v1", Kind: "EgressNetworkPolicy"},
+}
+
+type pruneResult struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Result    string `json:"result"`
+}
+
+func (files GeneratedFiles) stampTemplateSet(templateSet string) {
+	for _, file := range files.objects() {
+		objectLabels := file.labels()
+		objectLabels[managedByLabel] = managedByValue
+		objectLabels[templateSetLabel] = templateSet
+	}
+}
+
+func templateSetSelector(templateSet string) string {
+	// every object managed by the parser, when no template set is given
+	set := labels.Set{managedByLabel: managedByValue}
+	if templateSet != "" {
+		set[templateSetLabel] = templateSet
+	}
+	return labels.SelectorFromSet(set).String()
+}
+
+func (files GeneratedFiles) pruneKinds() []schema.GroupVersionKind {
+	// the default kinds, along with every namespaced kind in the bundle, each once whatever version it is given in,
+	// since listing a kind under any of its versions returns the same objects
+	seen := make(map[schema.GroupKind]bool)
+	var kinds []schema.GroupVersionKind
+	add := func(gvk schema.GroupVersionKind) {
+		if !seen[gvk.GroupKind()] {
+			seen[gvk.GroupKind()] = true
+			kinds = append(kinds, gvk)
+		}
+	}
+	for _, gvk := range pruneKinds {
+		add(gvk)
+	}
+	for _, file := range files.objects() {
+		if isNamespaced(file.kind()) {
+			add(schema.FromAPIVersionAndKind(file.field("apiVersion"), file.kind()))
+		}
+	}
+	return kinds
+}
+
+// liveObject is an object found in the cluster, along with the client it can be changed through
+type liveObject struct {
+	unstructured.Unstructured
+	group    string
+	kind     string
+	resource dynamic.ResourceInterface
+}
+
+func (c *clusterClient) listLabelled(kinds []schema.GroupVersionKind, namespace, selector string) ([]liveObject, error) {
+	var objects []liveObject
+	for _, gvk := range kinds {
+		mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if meta.IsNoMatchError(err) {
+			// the kind may still be served under another version, such as CronJob before batch/v1
+			mapping, err = c.mapper.RESTMapping(gvk.GroupKind())
+		}
+		if meta.IsNoMatchError(err) {
+			// not served by this cluster, such as EgressNetworkPolicy outside of OpenShift
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+			continue
+		}
+		resource := c.client.Resource(mapping.Resource).Namespace(namespace)
+		list, err := resource.List(metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return nil, fmt.Errorf("listing %s in %s: %s", gvk.Kind, namespace, err.Error())
+		}
+		for _, item := range list.Items {
+			objects = append(objects, liveObject{Unstructured: item, group: gvk.Group, kind: gvk.Kind, resource: resource})
+		}
+	}
+	sort.SliceStable(objects, func(i, j int) bool {
+		if objects[i].kind != objects[j].kind {
+			return objects[i].kind < objects[j].kind
+		}
+		return objects[i].GetName() < objects[j].GetName()
+	})
+	return objects, nil
+}
+
+func liveIdentity(group, kind, namespace, name string) string {
+	// group/kind namespace/name, leaving out the version, which a live object may be served under a different one of
+	return fmt.Sprintf("%s/%s %s/%s", group, kind, namespace, name)
+}
+
+func (files GeneratedFiles) identities(namespace string) map[string]bool {
+	// objects the templates leave unnamespaced end up in the project's namespace
+	identities := make(map[string]bool)
+	for _, file := range files.objects() {
+		gv, _ := schema.ParseGroupVersion(file.field("apiVersion"))
+		objectNamespace := file.namespace()
+		if objectNamespace == "" {
+			objectNamespace = namespace
+		}
+		identities[liveIdentity(gv.Group, file.kind(), objectNamespace, file.name())] = true
+	}
+	return identities
+}
+
+func (o liveObject) identity() string {
+	return liveIdentity(o.group, o.kind, o.GetNamespace(), o.GetName())
+}
+
+func (a *applier) prune(files GeneratedFiles, namespace, templateSet string, dryRun bool) ([]pruneResult, error) {
+	live, err := a.listLabelled(files.pruneKinds(), namespace, templateSetSelector(templateSet))
+	if err != nil {
+		return nil, err
+	}
+	wanted := files.identities(namespace)
+
+	var results []pruneResult
+	for _, item := range live {
+		if wanted[item.identity()] {
+			continue
+		}
+		result := pruneResult{Kind: item.kind, Namespace: namespace, Name: item.GetName()}
+		switch {
+		case strings.EqualFold(item.GetAnnotations()[pruneProtectedAnnotation], "true"):
+			result.Result = pruneProtected
+		case dryRun:
+			result.Result = pruneWouldPrune
+		default:
+			err := item.resource.Delete(item.GetName(), &metav1.DeleteOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				return results, fmt.Errorf("pruning %s %s/%s: %s", item.kind, namespace, item.GetName(), err.Error())
+			}
+			result.Result = prunePruned
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nicgrobler/gobins/internal/kubeconfig"
+	coreTypes "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	core "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+/*
+	quota-patch changes an existing project's quota without regenerating and re-applying everything else:
+
+		parser quota-patch -generate '{"projectname":"boogie-test","environment":"prd","optionals":[...]}' \
+			-kubeconfig ~/.kube/config -context prd | oc patch resourcequota default-quotas -n boogie-test --type merge -p "$(cat)"
+
+	The quota is rendered for the new input, compared with the live one, and a JSON merge patch of only the hard
+	limits that differ is written to STDOUT. A before and after table goes to STDERR. Any limit growing by more than
+	-max-increase times its current value is refused, unless -force is used, as is any limit which is new, or which
+	grows from zero, since neither has a current value to be a multiple of.
+*/
+
+const defaultMaxIncrease = 2.0
+
+type quotaChange struct {
+	Resource string
+	Before   *resource.Quantity // nil when the live quota does not set it
+	After    resource.Quantity
+}
+
+type quotaPatch struct {
+	Name    string
+	Changes []quotaChange
+	Patch   []byte // nil when nothing changes
+}
+
+func quantityFloat(q resource.Quantity) *big.Float {
+	// exact for any quantity, where MilliValue overflows for the largest
+	d := q.AsDec()
+	f := new(big.Float).SetInt(d.UnscaledBig())
+	scale := new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(int(d.Scale())))), nil))
+	if d.Scale() < 0 {
+		return f.Mul(f, scale)
+	}
+	return f.Quo(f, scale)
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+func (change quotaChange) fromNothing() bool {
+	// a limit the live quota does not set, or sets to zero, has no multiple to grow by
+	return change.Before == nil || change.Before.Sign() == 0
+}
+
+func (change quotaChange) ratio() float64 {
+	if change.fromNothing() {
+		return 0
+	}
+	ratio, _ := new(big.Float).Quo(quantityFloat(change.After), quantityFloat(*change.Before)).Float64()
+	return ratio
+}
+
+func (change quotaChange) exceeds(maxIncrease float64) bool {
+	if change.fromNothing() {
+		return change.After.Sign() > 0
+	}
+	return change.ratio() > maxIncrease
+}
+
+func quotaChanges(expected, live coreTypes.ResourceList) []quotaChange {
+	var changes []quotaChange
+	for name, after := range expected {
+		before, ok := live[name]
+		if ok && before.Cmp(after) == 0 {
+			continue
+		}
+		change := quotaChange{Resource: string(name), After: after}
+		if ok {
+			change.Before = &before
+		}
+		changes = append(changes, change)
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Resource < changes[j].Resource
+	})
+	return changes
+}
+
+func mergePatch(changes []quotaChange) ([]byte, error) {
+	hard := make(map[string]string, len(changes))
+	for _, change := range changes {
+		hard[change.Resource] = change.After.String()
+	}
+	return json.Marshal(map[string]interface{}{"spec": map[string]interface{}{"hard": hard}})
+}
+
+func checkIncreases(changes []quotaChange, maxIncrease float64) error {
+	var refused []string
+	for _, change := range changes {
+		switch {
+		case !change.exceeds(maxIncrease):
+		case change.Before == nil:
+			refused = append(refused, fmt.Sprintf("%s of %s is a new limit", change.Resource, change.After.String()))
+		case change.fromNothing():
+			refused = append(refused, fmt.Sprintf("%s from %s to %s is an increase from nothing", change.Resource, change.Before.String(), change.After.String()))
+		default:
+			refused = append(refused, fmt.Sprintf("%s from %s to %s is %.1f times the current limit", change.Resource, change.Before.String(), change.After.String(), change.ratio()))
+		}
+	}
+	if len(refused) > 0 {
+		return fmt.Errorf("increase larger than %.1f times refused:\n  %s", maxIncrease, strings.Join(refused, "\n  "))
+	}
+	return nil
+}
+
+func writeQuotaTable(w io.Writer, name string, changes []quotaChange) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "RESOURCEQUOTA\tRESOURCE\tBEFORE\tAFTER\tCHANGE\n")
+	for _, change := range changes {
+		before, ratio := "-", "new"
+		if change.Before != nil {
+			before = change.Before.String()
+		}
+		if !change.fromNothing() {
+			ratio = fmt.Sprintf("x%.2f", change.ratio())
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", name, change.Resource, before, change.After.String(), ratio)
+	}
+	return tw.Flush()
+}
+
+func (files GeneratedFiles) quota() (*coreTypes.ResourceQuota, error) {
+	var quotas []*coreTypes.ResourceQuota
+	for _, file := range files.objects() {
+		if file.kind() != "ResourceQuota" {
+			continue
+		}
+		obj, err := decodeTyped(file.Content)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", file.Filename, err.Error())
+		}
+		quota, ok := obj.(*coreTypes.ResourceQuota)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a v1 ResourceQuota", file.Filename)
+		}
+		quotas = append(quotas, quota)
+	}
+	if len(quotas) != 1 {
+		return nil, fmt.Errorf("templates must produce exactly one ResourceQuota, but produce %d", len(quotas))
+	}
+	return quotas[0], nil
+}
+
+func (c *config) quotaPatch(client core.CoreV1Interface, data *expectedInput, maxIncrease float64, force bool) (quotaPatch, error) {
+	files, err := c.generate(data)
+	if err != nil {
+		return quotaPatch{}, err
+	}
+	expected, err := files.quota()
+	if err != nil {
+		return quotaPatch{}, err
+	}
+	result := quotaPatch{Name: expected.Name}
+
+	live, err := client.ResourceQuotas(expected.Namespace).Get(expected.Name, metav1.GetOptions{})
+	if err != nil {
+		return result, err
+	}
+	result.Changes = quotaChanges(expected.Spec.Hard, live.Spec.Hard)
+	if len(result.Changes) == 0 {
+		return result, nil
+	}
+	if !force {
+		if err := checkIncreases(result.Changes, maxIncrease); err != nil {
+			return result, err
+		}
+	}
+	result.Patch, err = mergePatch(result.Changes)
+	return result, err
+}
+
+func runQuotaPatch(c *config, args []string) error {
+	cmd := newClusterCommand(c, "quota-patch", "the json payload, with the new optionals, of an existing project")
+	maxIncrease := cmd.flags.Float64("max-increase", defaultMaxIncrease, "the largest multiple of its current value any limit may grow to")
+	force := cmd.flags.Bool("force", false, "if used, allows increases beyond -max-increase")
+	data, err := cmd.parse(c, args)
+	if err != nil {
+		return err
+	}
+	config, err := kubeconfig.Get(c.kube.kubeconfig, c.kube.context, c.kube.local)
+	if err != nil {
+		return err
+	}
+	client, err := core.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("generate client from config failed: %s", err.Error())
+	}
+
+	result, err := c.quotaPatch(client, data, *maxIncrease, *force)
+	if len(result.Changes) > 0 {
+		if err := writeQuotaTable(os.Stderr, result.Name, result.Changes); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if result.Patch == nil {
+		fmt.Fprintf(os.Stderr, "resourcequota %s is already up to date\n", result.Name)
+		return nil
+	}
+	fmt.Println(string(result.Patch))
+	return nil
+}
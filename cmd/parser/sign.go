@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+/*
+	Bundles can be signed with an ed25519 key, producing a detached signature over their canonical serialization:
+	every file sorted by filename, with its content re-encoded as compact JSON with sorted keys, in the same
+	[{"content": {...}, "filename": "..."}] shape as the envelope output.
+
+	Because the canonical form only depends on filenames and decoded content, a bundle verifies the same whether it
+	was kept as an envelope stream, or written out as a directory. The signature file names the files it covers, so
+	that verifying a directory checks exactly those, and reports anything else found in it, such as a file left by an
+	earlier run, rather than mistaking it for part of the bundle. A v1 List or a YAML stream leaves out the filenames,
+	and the provenance, so neither can be signed.
+*/
+
+const signatureFile = "bundle.sig"
+
+// files which are written next to a bundle, but are not part of what is signed
+var unsignedFiles = map[string]bool{
+	signatureFile:     true,
+	kustomizationFile: true,
+}
+
+// rawContent is written out exactly as it is, rather than being encoded
+type rawContent []byte
+
+func normalizeContent(content interface{}) (interface{}, error) {
+	// round trips through JSON, so that structs, maps and decoded files all end up in the same form
+	b, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	var normalized interface{}
+	if err := decoder.Decode(&normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+type bundleSignature struct {
+	Files     []string `json:"files"`
+	Signature string   `json:"signature"`
+}
+
+func (files GeneratedFiles) signed() (GeneratedFiles, error) {
+	// the files a signature covers, normalized and sorted by filename
+	var signed GeneratedFiles
+	for _, file := range files {
+		name := path.Clean(file.Filename)
+		if unsignedFiles[path.Base(name)] {
+			continue
+		}
+		content, err := normalizeContent(file.Content)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", file.Filename, err.Error())
+		}
+		signed = append(signed, GeneratedFile{Filename: name, Content: content})
+	}
+	sort.SliceStable(signed, func(i, j int) bool {
+		return signed[i].Filename < signed[j].Filename
+	})
+	return signed, nil
+}
+
+func (files GeneratedFiles) filenames() []string {
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, file.Filename)
+	}
+	return names
+}
+
+func readPEM(filename, blockType string) ([]byte, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("%s does not contain a PEM encoded %s", filename, blockType)
+	}
+	return block.Bytes, nil
+}
+
+func loadPrivateKey(filename string) (ed25519.PrivateKey, error) {
+	der, err := readPEM(filename, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err.Error())
+	}
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an ed25519 private key", filename)
+	}
+	return private, nil
+}
+
+func loadPublicKey(filename string) (ed25519.PublicKey, error) {
+	der, err := readPEM(filename, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err.Error())
+	}
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an ed25519 public key", filename)
+	}
+	return public, nil
+}
+
+func (files GeneratedFiles) sign(key ed25519.PrivateKey) ([]byte, error) {
+	// returns the signature file, naming the files covered along with the base64 encoded signature
+	signed, err := files.signed()
+	if err != nil {
+		return nil, err
+	}
+	message, err := signed.envelope(true)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.MarshalIndent(bundleSignature{
+		Files:     signed.filenames(),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, message)),
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+func parseSignature(b []byte) (bundleSignature, error) {
+	var signature bundleSignature
+	if err := json.Unmarshal(b, &signature); err != nil {
+		return signature, fmt.Errorf("signature file is not valid: %s", err.Error())
+	}
+	if len(signature.Files) == 0 || signature.Signature == "" {
+		return signature, errors.New("signature file must name the files covered, and carry a signature")
+	}
+	return signature, nil
+}
+
+func (files GeneratedFiles) verify(key ed25519.PublicKey, raw []byte) error {
+	signature, err := parseSignature(raw)
+	if err != nil {
+		return err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(signature.Signature)
+	if err != nil {
+		return fmt.Errorf("signature is not valid base64: %s", err.Error())
+	}
+	signed, err := files.signed()
+	if err != nil {
+		return err
+	}
+
+	// exactly the files named are checked, any others are reported once the signature is known to be good
+	covered := make(map[string]bool, len(signature.Files))
+	for _, name := range signature.Files {
+		covered[name] = true
+	}
+	present := make(map[string]bool, len(signed))
+	var checked GeneratedFiles
+	var extra []string
+	for _, file := range signed {
+		present[file.Filename] = true
+		if covered[file.Filename] {
+			checked = append(checked, file)
+		} else {
+			extra = append(extra, file.Filename)
+		}
+	}
+	var missing []string
+	for _, name := range signature.Files {
+		if !present[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return errors.New("signed files are missing: " + strings.Join(missing, ", "))
+	}
+
+	message, err := checked.envelope(true)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(key, message, decoded) {
+		return errors.New("signature does not match bundle")
+	}
+	return notCovered(extra)
+}
+
+func notCovered(extra []string) error {
+	if len(extra) == 0 {
+		return nil
+	}
+	sort.Strings(extra)
+	return errors.New("signature matches, but these files are not covered by it: " + strings.Join(extra, ", "))
+}
+
+func (c *config) signBundle(files GeneratedFiles) (GeneratedFiles, error) {
+	toStdout := c.outputDir == "" && c.git.repo == ""
+	if toStdout && (c.outputFormat == outputList || c.outputFormat == outputYAML) {
+		return nil, fmt.Errorf("the %s output cannot be signed, since it leaves out filenames, use the envelope output or -out", c.outputFormat)
+	}
+	key, err := loadPrivateKey(c.signKey)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := files.sign(key)
+	if err != nil {
+		return nil, err
+	}
+	if c.signatureOut != "" {
+		return files, ioutil.WriteFile(c.signatureOut, signature, 0644)
+	}
+	if toStdout {
+		return nil, errors.New("a -signature file is required when writing to STDOUT")
+	}
+	// written, or committed, together with the rest of the bundle
+	return append(files, GeneratedFile{Filename: signatureFile, Content: rawContent(signature), SourceTemplate: "signature"}), nil
+}
+
+func readBundleDir(dir string, covered map[string]bool) (GeneratedFiles, []string, error) {
+	// reads back the covered files of a bundle written by -out, each decoded according to its extension, returning
+	// the names of any others found alongside them
+	var files GeneratedFiles
+	var extra []string
+	err := filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if unsignedFiles[path.Base(rel)] {
+			return nil
+		}
+		if !covered[rel] {
+			extra = append(extra, rel)
+			return nil
+		}
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(path.Ext(rel))
+		if ext == ".yaml" || ext == ".yml" {
+			if b, err = yaml.YAMLToJSON(b); err != nil {
+				return fmt.Errorf("%s: %s", rel, err.Error())
+			}
+		}
+		var content interface{}
+		if err := json.Unmarshal(b, &content); err != nil {
+			return fmt.Errorf("%s: %s", rel, err.Error())
+		}
+		files = append(files, GeneratedFile{Filename: rel, Content: content})
+		return nil
+	})
+	return files, extra, err
+}
+
+func readBundleStream(filename string) (GeneratedFiles, error) {
+	// reads back an envelope stream, from a file or "-" for STDIN
+	var b []byte
+	var err error
+	if filename == "-" {
+		b, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		b, err = ioutil.ReadFile(filename)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files GeneratedFiles
+	if err := json.Unmarshal(b, &files); err != nil {
+		return nil, fmt.Errorf("%s is not an envelope stream: %s", filename, err.Error())
+	}
+	return files, nil
+}
+
+func runVerify(args []string) error {
+	/*
+		parser verify -pubkey key.pub (-dir bundle/ | -in bundle.json -signature bundle.sig)
+	*/
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	publicKey := flags.String("pubkey", "", "PEM encoded ed25519 public key to verify against")
+	dir := flags.String("dir", "", "a bundle directory written by -out, signed by "+signatureFile+" within it unless -signature is used")
+	stream := flags.String("in", "", "an envelope stream to verify, or - for STDIN")
+	signaturePath := flags.String("signature", "", "the detached signature")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *publicKey == "" {
+		return errors.New("missing public key")
+	}
+	if (*dir == "") == (*stream == "") {
+		return errors.New("exactly one of -dir or -in is required")
+	}
+
+	key, err := loadPublicKey(*publicKey)
+	if err != nil {
+		return err
+	}
+
+	if *dir != "" && *signaturePath == "" {
+		*signaturePath = filepath.Join(*dir, signatureFile)
+	}
+	if *signaturePath == "" {
+		return errors.New("missing signature for stream")
+	}
+	signature, err := ioutil.ReadFile(*signaturePath)
+	if err != nil {
+		return err
+	}
+
+	if *stream != "" {
+		files, err := readBundleStream(*stream)
+		if err != nil {
+			return err
+		}
+		return files.verify(key, signature)
+	}
+	manifest, err := parseSignature(signature)
+	if err != nil {
+		return err
+	}
+	covered := make(map[string]bool, len(manifest.Files))
+	for _, name := range manifest.Files {
+		covered[name] = true
+	}
+	files, extra, err := readBundleDir(*dir, covered)
+	if err != nil {
+		return err
+	}
+	if err := files.verify(key, signature); err != nil {
+		return err
+	}
+	return notCovered(extra)
+}
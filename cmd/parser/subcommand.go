@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+/*
+	drift, teardown and quota-patch each render the bundle for a -generate payload, and then look at the project in a
+	cluster. clusterCommand holds the flags they share, and loads the payload through loadInput, exactly as the main
+	command does, -input-keyring check included, so that none of them acts on input the main command would refuse.
+
+	runSubcommand dispatches on the first argument, leaving anything which is not a subcommand to the main command.
+*/
+
+type clusterCommand struct {
+	flags   *flag.FlagSet
+	payload *string
+}
+
+func newClusterCommand(c *config, name, usage string) *clusterCommand {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	cmd := &clusterCommand{flags: flags, payload: flags.String("generate", "", usage)}
+	flags.StringVar(&c.kube.kubeconfig, "kubeconfig", "", "absolute path to the kubeconfig file")
+	flags.StringVar(&c.kube.context, "context", "", "the context within the kubeconfig")
+	flags.BoolVar(&c.kube.local, "local", false, "use the pod's service account rather than a kubeconfig")
+	flags.StringVar(&c.inputKeyring, "input-keyring", "", "if used, the -generate payload must carry a signature from one of the keys in this keyring")
+	return cmd
+}
+
+func (cmd *clusterCommand) parse(c *config, args []string) (*expectedInput, error) {
+	if err := cmd.flags.Parse(args); err != nil {
+		return nil, err
+	}
+	return c.loadInput(*cmd.payload)
+}
+
+func (c *config) loadInput(payload string) (*expectedInput, error) {
+	if payload == "" {
+		return nil, errors.New("missing input")
+	}
+	if c.inputKeyring != "" {
+		keys, err := loadKeyring(c.inputKeyring)
+		if err != nil {
+			return nil, fmt.Errorf("error in loading input keyring: %s", err.Error())
+		}
+		if err := verifyInput([]byte(payload), keys); err != nil {
+			return nil, fmt.Errorf("rejected input: %s", err.Error())
+		}
+	}
+	var data expectedInput
+	// unmarshal will call our custom decoders which do input verification
+	if err := json.Unmarshal([]byte(payload), &data); err != nil {
+		return nil, fmt.Errorf("error in parsing input: %s", err.Error())
+	}
+	return &data, nil
+}
+
+func (data *expectedInput) namespace() string {
+	// the project's namespace, as the templates name it
+	return strings.ToLower(data.ProjectName)
+}
+
+func mustGetConfig() *config {
+	config, err := getConfig("")
+	if err != nil {
+		exitLog("program exited due to error: " + err.Error())
+	}
+	return config
+}
+
+func runSubcommand(name string, args []string) bool {
+	switch name {
+	case "verify":
+		// generates nothing, and so needs no templates
+		if err := runVerify(args); err != nil {
+			exitLog("program exited due to failed verification: " + err.Error())
+		}
+		fmt.Println("verified")
+	case "explain":
+		if err := runExplain(mustGetConfig(), args); err != nil {
+			exitLog("program exited due to error: " + err.Error())
+		}
+	case "drift":
+		report, err := runDrift(mustGetConfig(), args)
+		if err != nil {
+			exitLog("program exited due to error: " + err.Error())
+		}
+		printSummary(report)
+		if report.Drifted {
+			os.Exit(driftExitCode)
+		}
+	case "teardown":
+		plan, err := runTeardown(mustGetConfig(), args)
+		if plan.Namespace != "" {
+			// the plan is worth seeing, even when it could not be carried out
+			printSummary(plan)
+		}
+		if err != nil {
+			exitLog("program exited due to error: " + err.Error())
+		}
+	case "quota-patch":
+		if err := runQuotaPatch(mustGetConfig(), args); err != nil {
+			exitLog("program exited due to error: " + err.Error())
+		}
+	default:
+		return false
+	}
+	return true
+}
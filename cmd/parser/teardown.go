@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+/*
+	teardown plans the decommissioning of a project, the opposite of applying its bundle:
+
+		parser teardown -generate '{...}' -kubeconfig ~/.kube/config -context prd [-execute] [-force]
+
+	The plan lists the bundle's objects in the reverse of apply order, so the Project goes last, and everything still
+	running in the namespace which the bundle did not create: workloads, routes and persistent volume claims. Claims
+	hold data, so while any remain the plan is blocked, and -execute refuses to delete anything unless -force is used.
+*/
+
+// kinds looked for in the namespace before anything is deleted
+var teardownKinds = []schema.GroupVersionKind{
+	{Group: "apps", Version: "v1", Kind: "Deployment"},
+	{Group: "apps", Version: "v1", Kind: "StatefulSet"},
+	{Group: "apps", Version: "v1", Kind: "DaemonSet"},
+	{Group: "apps.openshift.io", Version: "v1", Kind: "DeploymentConfig"},
+	{Group: "batch", Version: "v1", Kind: "Job"},
+	{Group: "batch", Version: "v1", Kind: "CronJob"},
+	{Group: "route.openshift.io", Version: "v1", Kind: "Route"},
+	{Version: "v1", Kind: "PersistentVolumeClaim"},
+}
+
+// kinds which hold data that is lost with the namespace
+var dataBearingKinds = map[string]bool{
+	"PersistentVolumeClaim": true,
+}
+
+type presentObject struct {
+	Kind        string `json:"kind"`
+	Name        string `json:"name"`
+	DataBearing bool   `json:"dataBearing"`
+}
+
+type teardownStep struct {
+	objectRef
+	Result string `json:"result,omitempty"` // deleted, or already gone, once executed
+}
+
+type teardownPlan struct {
+	Namespace string          `json:"namespace"`
+	Present   []presentObject `json:"present"`
+	Blocked   bool            `json:"blocked"`
+	Reason    string          `json:"reason,omitempty"`
+	Delete    []teardownStep  `json:"delete"`
+	Executed  bool            `json:"executed"`
+}
+
+func (files GeneratedFiles) inTeardownOrder() GeneratedFiles {
+	ordered := files.objects().inApplyOrder()
+	for i, j := 0, len(ordered)-1; i < j; i, j = i+1, j-1 {
+		ordered[i], ordered[j] = ordered[j], ordered[i]
+	}
+	return ordered
+}
+
+func (c *clusterClient) teardown(files GeneratedFiles, namespace string, force, execute bool) (teardownPlan, error) {
+	plan := teardownPlan{Namespace: namespace, Present: []presentObject{}, Delete: []teardownStep{}}
+
+	present, err := c.listLabelled(teardownKinds, namespace, "")
+	if err != nil {
+		return plan, err
+	}
+	var dataBearing []string
+	for _, item := range present {
+		object := presentObject{Kind: item.kind, Name: item.GetName(), DataBearing: dataBearingKinds[item.kind]}
+		if object.DataBearing {
+			dataBearing = append(dataBearing, item.kind+"/"+item.GetName())
+		}
+		plan.Present = append(plan.Present, object)
+	}
+	if len(dataBearing) > 0 && !force {
+		plan.Blocked = true
+		plan.Reason = "data bearing resources still exist: " + strings.Join(dataBearing, ", ")
+	}
+
+	ordered := files.inTeardownOrder()
+	for _, file := range ordered {
+		plan.Delete = append(plan.Delete, teardownStep{objectRef: objectRef{
+			Kind: file.kind(), Namespace: file.namespace(), Name: file.name(), Filename: file.Filename,
+		}})
+	}
+	if !execute {
+		return plan, nil
+	}
+	if plan.Blocked {
+		return plan, errors.New("refusing to tear down, " + plan.Reason)
+	}
+
+	plan.Executed = true
+	for i, file := range ordered {
+		u, err := toUnstructured(file)
+		if err != nil {
+			return plan, err
+		}
+		objects, err := c.resourceFor(u)
+		if err != nil {
+			return plan, fmt.Errorf("%s: %s", file.Filename, err.Error())
+		}
+		err = objects.Delete(u.GetName(), &metav1.DeleteOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			plan.Delete[i].Result = "already gone"
+		case err != nil:
+			return plan, fmt.Errorf("deleting %s %s: %s", u.GetKind(), u.GetName(), err.Error())
+		default:
+			plan.Delete[i].Result = "deleted"
+		}
+	}
+	return plan, nil
+}
+
+func runTeardown(c *config, args []string) (teardownPlan, error) {
+	cmd := newClusterCommand(c, "teardown", "the json payload of the project to decommission")
+	execute := cmd.flags.Bool("execute", false, "if used, deletes the planned objects, rather than only reporting the plan")
+	force := cmd.flags.Bool("force", false, "if used, tears down even though persistent volume claims still exist")
+	data, err := cmd.parse(c, args)
+	if err != nil {
+		return teardownPlan{}, err
+	}
+	files, err := c.generate(data)
+	if err != nil {
+		return teardownPlan{}, err
+	}
+	client, err := newClusterClient(c.kube)
+	if err != nil {
+		return teardownPlan{}, err
+	}
+	return client.teardown(files, data.namespace(), *force, *execute)
+}
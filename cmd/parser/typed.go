@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	kjson "k8s.io/apimachinery/pkg/runtime/serializer/json"
+	clientscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+/*
+	Each generated object is decoded into its typed Go representation, so that misspelt fields and type mismatches
+	are caught at generation time, rather than when the cluster rejects the object.
+*/
+
+var typedScheme = newTypedScheme()
+
+var strictDecoder = kjson.NewSerializerWithOptions(kjson.DefaultMetaFactory, typedScheme, typedScheme, kjson.SerializerOptions{Strict: true})
+
+func newTypedScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	if err := clientscheme.AddToScheme(scheme); err != nil {
+		panic(err)
+	}
+	if err := addOpenShiftTypes(scheme); err != nil {
+		panic(err)
+	}
+	return scheme
+}
+
+func decodeTyped(content interface{}) (runtime.Object, error) {
+	raw, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	obj, _, err := strictDecoder.Decode(raw, nil, nil)
+	if err != nil {
+		if runtime.IsStrictDecodingError(err) {
+			// the strict error embeds the entire object, which only repeats what we already know
+			return nil, fmt.Errorf("%s", strings.TrimPrefix(err.Error(), "strict decoder error for "+string(raw)+": "))
+		}
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (c *config) checkTypes(files []GeneratedFile) error {
+	for _, file := range files {
+		_, err := decodeTyped(file.Content)
+		if err == nil {
+			continue
+		}
+		if runtime.IsNotRegisteredError(err) && c.allowUnregisteredKinds {
+			continue
+		}
+		return fmt.Errorf("template %s: %s: %s", file.SourceTemplate, file.Filename, err.Error())
+	}
+	return nil
+}
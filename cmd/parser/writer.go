@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+/*
+	Writes each generated object into its own file beneath an output directory, using the filename set by its template.
+
+	Every file is encoded, and then staged as a temporary file in the directory it belongs in, before any of them is
+	renamed into place. A template which cannot be encoded, or a disk which fills up, therefore changes nothing, and
+	a reader never sees a partially written file. The directory given is written into, never replaced, so that it can
+	be a symlink, a mount point, or the working directory, and whatever else it holds is left alone.
+*/
+
+// what to do when a generated file already exists in the output directory
+const (
+	existingOverwrite = "overwrite"
+	existingSkip      = "skip"
+	existingFail      = "fail"
+)
+
+type writeResult struct {
+	Written []string `json:"written"`
+	Skipped []string `json:"skipped"`
+}
+
+func validExistingPolicy(policy string) bool {
+	return policy == existingOverwrite || policy == existingSkip || policy == existingFail
+}
+
+func safeJoin(dir, filename string) (string, error) {
+	// refuses any filename which would land outside of dir
+	if filename == "" {
+		return "", errors.New("empty filename")
+	}
+	if filepath.IsAbs(filename) || strings.HasPrefix(filename, "/") {
+		return "", fmt.Errorf("filename %s must be relative", filename)
+	}
+	clean := filepath.Clean(filepath.FromSlash(filename))
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("filename %s escapes the output directory", filename)
+	}
+	return filepath.Join(dir, clean), nil
+}
+
+func (file GeneratedFile) contentBytes(flat bool) ([]byte, error) {
+	if raw, ok := file.Content.(rawContent); ok {
+		return raw, nil
+	}
+	// files are encoded according to their extension, which for templates is always .json
+	ext := strings.ToLower(filepath.Ext(file.Filename))
+	if ext == ".yaml" || ext == ".yml" {
+		return yaml.Marshal(file.Content)
+	}
+	var b []byte
+	var err error
+	if flat {
+		b, err = json.Marshal(file.Content)
+	} else {
+		b, err = json.MarshalIndent(file.Content, "", "  ")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+func (files GeneratedFiles) writeDir(dir, policy string, flat bool) (writeResult, error) {
+	result := writeResult{Written: []string{}, Skipped: []string{}}
+	if !validExistingPolicy(policy) {
+		return result, fmt.Errorf("unknown policy for existing files: %s", policy)
+	}
+
+	// decide what is to be written before touching the disk
+	var pending GeneratedFiles
+	var existing []string
+	for _, file := range files {
+		target, err := safeJoin(dir, file.Filename)
+		if err != nil {
+			return result, fmt.Errorf("template %s: %s", file.SourceTemplate, err.Error())
+		}
+		if _, err := os.Lstat(target); err == nil {
+			switch policy {
+			case existingSkip:
+				result.Skipped = append(result.Skipped, file.Filename)
+				continue
+			case existingFail:
+				existing = append(existing, file.Filename)
+				continue
+			}
+		} else if !os.IsNotExist(err) {
+			return result, err
+		}
+		pending = append(pending, file)
+	}
+	if len(existing) > 0 {
+		return result, errors.New("refusing to overwrite existing files: " + strings.Join(existing, ", "))
+	}
+
+	contents := make([][]byte, len(pending))
+	for i, file := range pending {
+		b, err := file.contentBytes(flat)
+		if err != nil {
+			return result, err
+		}
+		contents[i] = b
+	}
+
+	// a file staged beside its target can always be renamed over it, whatever filesystem that is on
+	staged := make([]string, 0, len(pending))
+	defer func() {
+		for _, tmp := range staged {
+			os.Remove(tmp)
+		}
+	}()
+	for i, file := range pending {
+		target, _ := safeJoin(dir, file.Filename)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return result, err
+		}
+		tmp, err := writeTemp(filepath.Dir(target), filepath.Base(target), contents[i])
+		if err != nil {
+			return result, err
+		}
+		staged = append(staged, tmp)
+	}
+
+	for i, file := range pending {
+		target, _ := safeJoin(dir, file.Filename)
+		if err := os.Rename(staged[i], target); err != nil {
+			return result, err
+		}
+		result.Written = append(result.Written, file.Filename)
+	}
+	return result, nil
+}
+
+func writeTemp(dir, name string, b []byte) (string, error) {
+	f, err := ioutil.TempFile(dir, "."+name+".tmp-")
+	if err != nil {
+		return "", err
+	}
+	// TempFile creates the file readable by its owner alone
+	err = f.Chmod(0644)
+	if err == nil {
+		_, err = f.Write(b)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
@@ -6,4 +6,5 @@ require (
 	k8s.io/api v0.17.0
 	k8s.io/apimachinery v0.17.0
 	k8s.io/client-go v0.17.0
+	sigs.k8s.io/yaml v1.1.0
 )
@@ -0,0 +1,42 @@
+// Package kubeconfig builds the client configuration shared by the commands which talk to a cluster.
+package kubeconfig
+
+import (
+	"errors"
+	"fmt"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// BuildConfigFromFlags loads the kubeconfig at kubeconfigPath, using context rather than its current context.
+func BuildConfigFromFlags(context, kubeconfigPath string) (*rest.Config, error) {
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfigPath},
+		&clientcmd.ConfigOverrides{
+			CurrentContext: context,
+		}).ClientConfig()
+}
+
+// Get returns the in-cluster config when localOnly is set, which needs a service account, and otherwise the
+// config for context within the kubeconfig, both of which must then be given.
+func Get(kubeconfig, clusterContext string, localOnly bool) (*rest.Config, error) {
+	if localOnly {
+		// creates the in-cluster config
+		config, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("building in-cluster config failed: %s", err.Error())
+		}
+		return config, nil
+	}
+	if kubeconfig == "" || clusterContext == "" {
+		return nil, errors.New("both a kubeconfig and a context are required when not running in a pod")
+	}
+
+	// use the chosen context in kubeconfig
+	config, err := BuildConfigFromFlags(clusterContext, kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("building config failed: %s", err.Error())
+	}
+	return config, nil
+}